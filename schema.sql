@@ -212,4 +212,484 @@ CREATE TYPE rice_state AS ENUM (
 );
 
 ALTER TABLE rices
-ADD COLUMN "state" rice_state NOT NULL DEFAULT 'waiting';
\ No newline at end of file
+ADD COLUMN "state" rice_state NOT NULL DEFAULT 'waiting';
+
+-- perceptual hashes of previews used for detecting re-uploaded screenshots
+ALTER TABLE rice_previews
+ADD COLUMN phash BIGINT;
+
+CREATE INDEX rice_previews_phash_idx ON rice_previews (phash) WHERE phash IS NOT NULL;
+
+CREATE TABLE rice_preview_duplicates (
+    preview_id UUID NOT NULL REFERENCES rice_previews(id) ON DELETE CASCADE,
+    original_preview_id UUID NOT NULL REFERENCES rice_previews(id) ON DELETE CASCADE,
+    distance INT NOT NULL CHECK (distance >= 0 AND distance <= 64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (preview_id, original_preview_id)
+);
+
+-- full moderation lifecycle of a rice, see `models.RiceState` for allowed transitions
+ALTER TYPE rice_state ADD VALUE 'draft' BEFORE 'waiting';
+ALTER TYPE rice_state ADD VALUE 'rejected';
+ALTER TYPE rice_state ADD VALUE 'hidden';
+ALTER TYPE rice_state ADD VALUE 'archived';
+
+-- reason of the latest state change (e.g. why rice was rejected), visible to the author
+ALTER TABLE rices
+ADD COLUMN state_reason TEXT;
+
+CREATE TABLE rice_state_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rice_id UUID NOT NULL REFERENCES rices(id) ON DELETE CASCADE,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    old_state rice_state NOT NULL,
+    new_state rice_state NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rice_state_history_rice_idx ON rice_state_history (rice_id, created_at);
+
+-- moderation queue: moderators claim waiting rices so they don't review the same one twice
+CREATE TABLE rice_review_claims (
+    rice_id UUID PRIMARY KEY REFERENCES rices(id) ON DELETE CASCADE,
+    moderator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    claimed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- internal notes visible only to moderators
+CREATE TABLE rice_review_notes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rice_id UUID NOT NULL REFERENCES rices(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rice_review_notes_rice_idx ON rice_review_notes (rice_id, created_at);
+
+-- structured report workflow
+CREATE TYPE report_category AS ENUM (
+    'spam',
+    'stolen_content',
+    'nsfw',
+    'malware',
+    'harassment',
+    'other'
+);
+
+CREATE TYPE report_status AS ENUM (
+    'open',
+    'in_review',
+    'resolved',
+    'dismissed'
+);
+
+CREATE TYPE report_action AS ENUM (
+    'none',
+    'content_removed',
+    'user_banned'
+);
+
+ALTER TABLE reports
+ADD COLUMN category report_category NOT NULL DEFAULT 'other',
+ADD COLUMN status report_status NOT NULL DEFAULT 'open',
+ADD COLUMN resolution_note TEXT,
+ADD COLUMN handled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN action_taken report_action,
+ADD COLUMN resolved_at TIMESTAMPTZ;
+
+UPDATE reports SET status = 'resolved', action_taken = 'none' WHERE is_closed = true;
+
+ALTER TABLE reports DROP CONSTRAINT reports_reporter_id_reason_is_closed_key;
+ALTER TABLE reports DROP COLUMN is_closed;
+
+-- users can't file the same kind of report against the same resource until it's handled
+CREATE UNIQUE INDEX reports_active_rice_key
+    ON reports (reporter_id, rice_id, category)
+    WHERE rice_id IS NOT NULL AND status IN ('open', 'in_review');
+
+CREATE UNIQUE INDEX reports_active_comment_key
+    ON reports (reporter_id, comment_id, category)
+    WHERE comment_id IS NOT NULL AND status IN ('open', 'in_review');
+
+-- users and single previews can be reported too
+CREATE TYPE report_target AS ENUM (
+    'rice',
+    'comment',
+    'user',
+    'preview'
+);
+
+-- preview reports keep `rice_id` of the rice the preview belongs to,
+-- so they aren't lost when moderator removes the reported preview
+ALTER TABLE reports
+ADD COLUMN target_type report_target,
+ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+ADD COLUMN preview_id UUID REFERENCES rice_previews(id) ON DELETE SET NULL;
+
+UPDATE reports SET target_type = CASE WHEN rice_id IS NOT NULL THEN 'rice' ELSE 'comment' END::report_target;
+
+ALTER TABLE reports ALTER COLUMN target_type SET NOT NULL;
+
+ALTER TABLE reports DROP CONSTRAINT reports_check;
+ALTER TABLE reports ADD CONSTRAINT reports_target_check CHECK (
+    CASE target_type
+        WHEN 'rice' THEN rice_id IS NOT NULL AND comment_id IS NULL AND user_id IS NULL AND preview_id IS NULL
+        WHEN 'comment' THEN comment_id IS NOT NULL AND rice_id IS NULL AND user_id IS NULL AND preview_id IS NULL
+        WHEN 'user' THEN user_id IS NOT NULL AND rice_id IS NULL AND comment_id IS NULL AND preview_id IS NULL
+        WHEN 'preview' THEN rice_id IS NOT NULL AND comment_id IS NULL AND user_id IS NULL
+    END
+);
+
+DROP INDEX reports_active_rice_key;
+CREATE UNIQUE INDEX reports_active_rice_key
+    ON reports (reporter_id, rice_id, category)
+    WHERE target_type = 'rice' AND status IN ('open', 'in_review');
+
+CREATE UNIQUE INDEX reports_active_user_key
+    ON reports (reporter_id, user_id, category)
+    WHERE target_type = 'user' AND status IN ('open', 'in_review');
+
+CREATE UNIQUE INDEX reports_active_preview_key
+    ON reports (reporter_id, preview_id, category)
+    WHERE target_type = 'preview' AND status IN ('open', 'in_review');
+
+-- comments hidden automatically after receiving too many reports (rices use 'hidden' state instead)
+ALTER TABLE rice_comments
+ADD COLUMN is_hidden BOOL NOT NULL DEFAULT false;
+
+-- ban appeals: every ban can be appealed once by the banned user
+CREATE TYPE appeal_status AS ENUM (
+    'pending',
+    'accepted',
+    'denied'
+);
+
+ALTER TABLE user_bans
+ADD COLUMN appeal_message TEXT,
+ADD COLUMN appeal_status appeal_status,
+ADD COLUMN appealed_at TIMESTAMPTZ,
+ADD COLUMN appeal_response TEXT,
+ADD COLUMN appeal_reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN appeal_reviewed_at TIMESTAMPTZ;
+
+CREATE INDEX user_bans_pending_appeals_idx ON user_bans (appealed_at) WHERE appeal_status = 'pending';
+
+-- audit log of every action admins took on bans
+CREATE TYPE ban_change_action AS ENUM (
+    'created',
+    'updated',
+    'revoked'
+);
+
+CREATE TABLE user_ban_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ban_id UUID NOT NULL REFERENCES user_bans(id) ON DELETE CASCADE,
+    admin_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action ban_change_action NOT NULL,
+    old_reason TEXT,
+    new_reason TEXT,
+    old_expires_at TIMESTAMPTZ,
+    new_expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_ban_changes_ban_idx ON user_ban_changes (ban_id, created_at);
+
+ALTER TABLE user_bans
+ADD COLUMN revoked_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- partial restrictions: bans can block only one kind of action instead of the whole account
+CREATE TYPE ban_scope AS ENUM (
+    'all',
+    'comment',
+    'upload',
+    'star',
+    'report'
+);
+
+ALTER TABLE user_bans
+ADD COLUMN scope ban_scope NOT NULL DEFAULT 'all';
+
+-- only full bans make user banned
+CREATE OR REPLACE VIEW users_with_ban_status AS
+SELECT
+    u.*,
+    EXISTS (
+        SELECT 1
+        FROM user_bans b
+        WHERE
+            b.user_id = u.id
+            AND (b.expires_at > NOW() OR b.expires_at IS NULL)
+            AND b.is_revoked = false
+            AND b.scope = 'all'
+    ) AS is_banned
+FROM users u;
+
+-- network-level bans stop banned users from simply creating new accounts
+CREATE TABLE ip_bans (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    network CIDR NOT NULL,
+    admin_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ip_bans_network_idx ON ip_bans USING gist (network inet_ops);
+
+-- addresses used by each user, moderators use them to find linked accounts
+CREATE TABLE user_ips (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    registration_ip INET,
+    last_login_ip INET,
+    last_login_at TIMESTAMPTZ
+);
+
+CREATE INDEX user_ips_registration_idx ON user_ips (registration_ip);
+CREATE INDEX user_ips_last_login_idx ON user_ips (last_login_ip);
+
+-- shadow ban: user can still use the service but nobody else sees their content
+ALTER TYPE ban_scope ADD VALUE 'shadow';
+
+CREATE VIEW shadow_banned_users AS
+SELECT DISTINCT user_id
+FROM user_bans
+WHERE
+    scope = 'shadow'
+    AND (expires_at > NOW() OR expires_at IS NULL)
+    AND is_revoked = false;
+
+-- content filter rules replacing the word blacklist from config
+CREATE TYPE filter_rule_kind AS ENUM (
+    'word',
+    'regex'
+);
+
+CREATE TYPE filter_rule_action AS ENUM (
+    'reject',
+    'flag',
+    'mask'
+);
+
+CREATE TABLE content_filter_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pattern TEXT NOT NULL,
+    kind filter_rule_kind NOT NULL,
+    action filter_rule_action NOT NULL,
+    -- match against text with leetspeak and diacritics normalized
+    normalize BOOL NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (pattern, kind)
+);
+
+CREATE TRIGGER update_content_filter_rules_updated_at
+    BEFORE UPDATE ON content_filter_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+-- content flagged by the filter is reported by the system itself
+ALTER TABLE reports
+ALTER COLUMN reporter_id DROP NOT NULL;
+
+-- threaded comment replies
+ALTER TABLE rice_comments
+ADD COLUMN parent_id UUID REFERENCES rice_comments(id) ON DELETE CASCADE,
+-- 0 for top level comments
+ADD COLUMN depth INT NOT NULL DEFAULT 0,
+-- comments with replies are only cleared on delete so the discussion under them stays intact
+ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_rice_comments_parent_id ON rice_comments(parent_id);
+
+-- emoji reactions on comments, each user can leave one reaction per comment
+CREATE TYPE comment_reaction AS ENUM (
+    'like',
+    'love',
+    'laugh',
+    'fire',
+    'sad'
+);
+
+CREATE TABLE comment_reactions (
+    comment_id UUID NOT NULL REFERENCES rice_comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction comment_reaction NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (comment_id, user_id)
+);
+
+-- every version of comment content is kept so edits and deletions don't destroy evidence
+CREATE TABLE comment_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    comment_id UUID NOT NULL REFERENCES rice_comments(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    edited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_comment_revisions_comment_id ON comment_revisions(comment_id, created_at);
+
+-- existing comments start their history with the current content
+INSERT INTO comment_revisions (comment_id, content, edited_by, created_at)
+SELECT id, content, author_id, created_at
+FROM rice_comments;
+
+-- deleted comments are only soft-deleted now
+ALTER TABLE rice_comments
+ADD COLUMN edited_at TIMESTAMPTZ,
+ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- rice authors can moderate the discussion under their rices
+ALTER TABLE rices
+ADD COLUMN comments_locked BOOL NOT NULL DEFAULT false,
+ADD COLUMN pinned_comment_id UUID REFERENCES rice_comments(id) ON DELETE SET NULL;
+
+-- separate from is_hidden so rice authors can't undo moderators' decisions and the other way around
+ALTER TABLE rice_comments
+ADD COLUMN hidden_by_rice_author BOOL NOT NULL DEFAULT false;
+
+-- users mentioned with @username in comments
+CREATE TABLE comment_mentions (
+    comment_id UUID NOT NULL REFERENCES rice_comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE INDEX idx_comment_mentions_user_id ON comment_mentions(user_id);
+
+-- events users are notified about
+CREATE TYPE notification_type AS ENUM (
+    'mention'
+);
+
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type notification_type NOT NULL,
+    -- user who caused the event, NULL for system events
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    rice_id UUID REFERENCES rices(id) ON DELETE CASCADE,
+    comment_id UUID REFERENCES rice_comments(id) ON DELETE CASCADE,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id, created_at DESC);
+
+-- notifications about activity on users' rices and moderation decisions
+ALTER TYPE notification_type ADD VALUE 'comment';
+ALTER TYPE notification_type ADD VALUE 'reply';
+ALTER TYPE notification_type ADD VALUE 'star';
+ALTER TYPE notification_type ADD VALUE 'download';
+ALTER TYPE notification_type ADD VALUE 'rice_accepted';
+ALTER TYPE notification_type ADD VALUE 'rice_rejected';
+ALTER TYPE notification_type ADD VALUE 'ban';
+
+-- type specific details, e.g. rejection or ban reason
+ALTER TABLE notifications
+ADD COLUMN data JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- missing row means the notification type is enabled
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type notification_type NOT NULL,
+    enabled BOOL NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- optional email addresses, kept in a separate table so views selecting u.* don't have to be recreated
+CREATE TABLE user_emails (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL UNIQUE,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TYPE email_status AS ENUM (
+    'pending',
+    'sent',
+    'failed'
+);
+
+-- outgoing emails are sent by a background worker and retried with exponential backoff
+CREATE TABLE email_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    recipient TEXT NOT NULL,
+    template TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    status email_status NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_email_queue_pending ON email_queue(next_attempt_at) WHERE status = 'pending';
+
+CREATE TYPE user_token_purpose AS ENUM (
+    'email_verification',
+    'password_reset'
+);
+
+-- single-use tokens sent by email, only their sha256 hashes are stored
+CREATE TABLE user_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose user_token_purpose NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    -- address the token was sent to, verification is only valid for this one
+    email CITEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+
+-- access and refresh tokens issued before revoked_at are rejected, e.g. after password reset
+CREATE TABLE session_revocations (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TYPE login_lockout_scope AS ENUM (
+    'username',
+    'ip'
+);
+
+-- audit log of logins locked after too many failed attempts
+CREATE TABLE login_lockouts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    scope login_lockout_scope NOT NULL,
+    -- username that was tried, it doesn't have to exist
+    username CITEXT,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip INET NOT NULL,
+    failed_attempts INT NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_login_lockouts_created_at ON login_lockouts(created_at DESC);
+
+-- unverified addresses can't be proven to belong to anyone so they don't block others from using them
+ALTER TABLE user_emails DROP CONSTRAINT user_emails_email_key;
+CREATE UNIQUE INDEX idx_user_emails_verified_email ON user_emails(email) WHERE verified_at IS NOT NULL;
+
+-- replies outlive their parent when it's removed together with its author's account,
+-- they're shown as replies to a removed comment (parent_id is NULL but depth isn't 0)
+ALTER TABLE rice_comments
+DROP CONSTRAINT rice_comments_parent_id_fkey,
+ADD CONSTRAINT rice_comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES rice_comments(id) ON DELETE SET NULL;
+
+-- reactions on comments can be restricted separately from starring rices
+ALTER TYPE ban_scope ADD VALUE 'react';
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Banned users can't log in so they have to authenticate with credentials to appeal
+func AppealBan(c *gin.Context) {
+	var body models.AppealBanDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := findUserByCredentials(c, body.Username, body.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !user.IsBanned {
+		c.Error(errs.UserError("Your account is not banned", http.StatusConflict))
+		return
+	}
+
+	ban, err := repository.FetchUserBan(user.ID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	ban, err = repository.InsertBanAppeal(ban.ID, body.Message)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(errs.UserError("You have already appealed this ban", http.StatusConflict))
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, ban.ToDTO())
+}
+
+func FetchBanAppeals(c *gin.Context) {
+	var query struct {
+		Status string `form:"status,default=pending" binding:"oneof=pending accepted denied"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Error(errs.UserError("Failed to parse status query parameter", http.StatusBadRequest))
+		return
+	}
+
+	appeals, err := repository.FetchBanAppeals(models.AppealStatus(query.Status))
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BanAppealsToDTO(appeals))
+}
+
+func ReviewBanAppeal(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path struct {
+		BanID string `uri:"banId" binding:"required,uuid"`
+	}
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(errs.UserError("Invalid ban ID path parameter. It must be a valid UUID.", http.StatusBadRequest))
+		return
+	}
+
+	var body models.ReviewBanAppealDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// user deserves to know why their appeal didn't work
+	status := models.AppealStatus(body.Status)
+	if status == models.AppealDenied && body.Response == nil {
+		c.Error(errs.UserError("Response is required when denying an appeal", http.StatusBadRequest))
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	ban, err := repository.ReviewBanAppeal(tx, path.BanID, status, token.Subject, body.Response)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(errs.UserError("Pending appeal for provided ban not found", http.StatusNotFound))
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// accepted appeal has to lift the ban, otherwise it couldn't be reviewed again
+	if status == models.AppealAccepted {
+		if err := repository.RevokeBanTx(tx, ban.UserID.String(), token.Subject); err != nil {
+			c.Error(errs.InternalError(err))
+			return
+		}
+
+		ban.IsRevoked = true
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, ban.ToDTO())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"math"
 	"net/http"
@@ -9,11 +10,17 @@ import (
 	"ricehub/src/repository"
 	"ricehub/src/security"
 	"ricehub/src/utils"
+	"strconv"
+	"time"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 )
 
 var invalidCredentials = errs.UserError("Invalid credentials provided", http.StatusUnauthorized)
@@ -26,12 +33,12 @@ func Register(c *gin.Context) {
 	}
 
 	// check if username or display name contains blacklisted words
-	if utils.IsUsernameBlacklisted(credentials.Username) {
+	if security.IsUsernameBlacklisted(credentials.Username) {
 		c.Error(errs.UserError("You can't use this username! Please try again with a different one.", http.StatusUnprocessableEntity))
 		return
 	}
 
-	if utils.IsDisplayNameBlacklisted(credentials.DisplayName) {
+	if security.IsDisplayNameBlacklisted(credentials.DisplayName) {
 		c.Error(errs.BlacklistedDisplayName)
 		return
 	}
@@ -55,42 +62,72 @@ func Register(c *gin.Context) {
 	}
 
 	// insert new user
-	err = repository.InsertUser(credentials.Username, credentials.DisplayName, pass)
+	userID, err := repository.InsertUser(credentials.Username, credentials.DisplayName, pass, c.ClientIP(), credentials.Email)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			c.Error(errs.UserError("Username is already taken", http.StatusConflict))
+			return
+		}
+
 		c.Error(errs.InternalError(err))
 		return
 	}
 
+	if credentials.Email != nil {
+		user := &models.User{ID: uuid.MustParse(userID), Username: credentials.Username, DisplayName: credentials.DisplayName}
+		sendEmailVerification(user, *credentials.Email, "welcome")
+	}
+
 	c.Status(http.StatusCreated)
 }
 
-func Login(c *gin.Context) {
-	var credentials models.LoginDTO
-	if err := utils.ValidateJSON(c, &credentials); err != nil {
-		c.Error(err)
-		return
+// Finds user by username and checks if the password matches. Bans are not checked here.
+// Failed attempts are counted per username and IP address, too many of them block the login for a while.
+func findUserByCredentials(c *gin.Context, username string, password string) (*models.User, error) {
+	ip := c.ClientIP()
+
+	retryAfter, err := security.CheckLoginAllowed(username, ip)
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return nil, err
 	}
 
-	// find user by username
-	user, err := repository.FindUserByUsername(credentials.Username)
+	user, err := repository.FindUserByUsername(username)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			c.Error(invalidCredentials)
-			return
+			// takes as long as a real check so unknown usernames can't be told apart by timing
+			security.CompareDummyPassword(password)
+			security.RecordLoginFailure(username, ip)
+			return nil, invalidCredentials
 		}
 
-		c.Error(errs.InternalError(err))
-		return
+		return nil, errs.InternalError(err)
 	}
 
-	// check if password matches
-	match, err := argon2id.ComparePasswordAndHash(credentials.Password, user.Password)
+	match, err := argon2id.ComparePasswordAndHash(password, user.Password)
 	if err != nil {
-		c.Error(errs.InternalError(err))
-		return
+		return nil, errs.InternalError(err)
 	}
 	if !match {
-		c.Error(invalidCredentials)
+		security.RecordLoginFailure(username, ip)
+		return nil, invalidCredentials
+	}
+
+	security.ResetLoginFailures(username)
+	return user, nil
+}
+
+func Login(c *gin.Context) {
+	var credentials models.LoginDTO
+	if err := utils.ValidateJSON(c, &credentials); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := findUserByCredentials(c, credentials.Username, credentials.Password)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -99,6 +136,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if err := repository.UpdateLastLoginIP(user.ID.String(), c.ClientIP()); err != nil {
+		zap.L().Error("Failed to record last login IP", zap.String("userID", user.ID.String()), zap.Error(err))
+	}
+
 	// create tokens
 	refresh, err := security.NewRefreshToken(user.ID)
 	if err != nil {
@@ -142,6 +183,12 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// tokens issued before password reset are no longer valid
+	if err := security.VerifySession(refresh.Subject, refresh.IssuedAt); err != nil {
+		c.Error(err)
+		return
+	}
+
 	// check user data from database
 	user, err := repository.FindUserById(refresh.Subject)
 	if err != nil {
@@ -174,3 +221,115 @@ func LogOut(c *gin.Context) {
 	c.SetCookie("refresh_token", "", -10, "/", utils.Config.CookiesDomain, true, true)
 	c.Status(http.StatusOK)
 }
+
+// Sends reset link if the address belongs to a user. It runs in the background
+// so response time doesn't reveal whether the account exists.
+func sendPasswordReset(email string) {
+	user, err := repository.FindUserByVerifiedEmail(email)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			zap.L().Error("Failed to find user requesting password reset", zap.Error(err))
+		}
+		return
+	}
+
+	token, hash, err := security.NewOneTimeToken()
+	if err != nil {
+		zap.L().Error("Failed to generate password reset token", zap.Error(err))
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.Config.Email.PasswordResetExpiration)
+	if err := repository.InsertUserToken(user.ID.String(), models.PasswordResetToken, hash, email, expiresAt); err != nil {
+		zap.L().Error("Failed to save password reset token", zap.String("userId", user.ID.String()), zap.Error(err))
+		return
+	}
+
+	queueEmail(email, "password_reset", map[string]any{
+		"username":    user.Username,
+		"displayName": user.DisplayName,
+		"link":        emailLink("reset-password", token),
+		"expiresIn":   utils.Config.Email.PasswordResetExpiration.String(),
+	})
+}
+
+func RequestPasswordReset(c *gin.Context) {
+	var body models.RequestPasswordResetDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	go sendPasswordReset(body.Email)
+
+	// the same response no matter if the account exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account with this verified email address exists, a reset link is on its way."})
+}
+
+func ResetPassword(c *gin.Context) {
+	var body models.ResetPasswordDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	hash, err := argon2id.CreateHash(body.NewPassword, argon2id.DefaultParams)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	resetToken, err := repository.ConsumeUserToken(tx, security.HashOneTimeToken(body.Token), models.PasswordResetToken)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(invalidEmailToken)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+	userID := resetToken.UserID.String()
+
+	if err := repository.UpdateUserPasswordTx(tx, userID, hash); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if err := repository.DeleteUnusedUserTokens(tx, userID, models.PasswordResetToken); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	// whoever knew the old password shouldn't stay logged in
+	revokedAt, err := repository.RevokeSessions(tx, userID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	security.CacheSessionsRevocation(userID, revokedAt)
+
+	if user, err := repository.FindUserById(userID); err == nil {
+		queueEmail(resetToken.Email, "password_changed", map[string]any{
+			"username":    user.Username,
+			"displayName": user.DisplayName,
+		})
+	} else {
+		zap.L().Error("Failed to find user after password reset", zap.String("userId", userID), zap.Error(err))
+	}
+
+	c.SetCookie("refresh_token", "", -10, "/", utils.Config.CookiesDomain, true, true)
+	c.Status(http.StatusNoContent)
+}
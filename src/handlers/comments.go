@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"ricehub/src/errs"
@@ -8,11 +9,14 @@ import (
 	"ricehub/src/repository"
 	"ricehub/src/security"
 	"ricehub/src/utils"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 )
 
 type commentsPath struct {
@@ -20,6 +24,42 @@ type commentsPath struct {
 }
 
 var invalidCommentId = errs.UserError("Invalid comment ID path parameter. It must be a valid UUID.", http.StatusBadRequest)
+var blacklistedComment = errs.UserError("Comment contains blacklisted words!", http.StatusUnprocessableEntity)
+var commentNotFound = errs.UserError("Comment with provided ID not found", http.StatusNotFound)
+var commentsLocked = errs.UserError("Comments on this rice are locked", http.StatusForbidden)
+var parentCommentNotFound = errs.UserError("Comment you're replying to doesn't exist", http.StatusNotFound)
+
+var commentSorts = []repository.CommentSort{repository.NewestComments, repository.OldestComments, repository.MostLikedComments}
+
+// Binds sorting and cursor query parameters shared by comment listings
+func bindCommentPagination(c *gin.Context) (*repository.CommentPagination, error) {
+	var query struct {
+		Sort              string    `form:"sort,default=newest"`
+		LastID            *string   `form:"lastId" binding:"omitempty,uuid"`
+		LastCreatedAt     time.Time `form:"lastCreatedAt"`
+		LastReactionCount int       `form:"lastReactionCount,default=-1"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return nil, errs.UserError("Failed to parse pagination query parameters", http.StatusBadRequest)
+	}
+
+	sort := repository.CommentSort(query.Sort)
+	if !slices.Contains(commentSorts, sort) {
+		return nil, errs.UserError("Unsupported sorting method provided", http.StatusBadRequest)
+	}
+
+	pag := &repository.CommentPagination{
+		Sort:              sort,
+		LastID:            query.LastID,
+		LastCreatedAt:     query.LastCreatedAt,
+		LastReactionCount: query.LastReactionCount,
+	}
+	if _, ok := pag.Cursor(); query.LastID != nil && !ok {
+		return nil, errs.UserError("lastId has to be provided together with lastCreatedAt or lastReactionCount depending on the sorting method", http.StatusBadRequest)
+	}
+
+	return pag, nil
+}
 
 func checkCanUserModifyComment(token *security.AccessToken, commentID string) error {
 	if token.IsAdmin {
@@ -34,12 +74,101 @@ func checkCanUserModifyComment(token *security.AccessToken, commentID string) er
 	return nil
 }
 
+// Makes sure the reply is posted under the same rice and doesn't exceed the depth limit.
+// Returns the parent comment (nil for top level comments) and depth of the new comment.
+func checkCanReplyTo(parentID *string, riceID string) (*models.RiceCommentWithSlug, int, error) {
+	if parentID == nil {
+		return nil, 0, nil
+	}
+
+	parent, err := repository.FindCommentById(*parentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, parentCommentNotFound
+		}
+
+		return nil, 0, errs.InternalError(err)
+	}
+
+	if parent.IsHidden || parent.RiceID.String() != riceID {
+		return nil, 0, parentCommentNotFound
+	}
+	if parent.DeletedAt != nil {
+		return nil, 0, errs.UserError("You can't reply to deleted comment", http.StatusConflict)
+	}
+
+	depth := parent.Depth + 1
+	if depth > utils.Config.Limits.MaxCommentDepth {
+		return nil, 0, errs.UserError("Replies can't be nested any deeper", http.StatusUnprocessableEntity)
+	}
+
+	return &parent, depth, nil
+}
+
+// Rice authors can moderate the discussion under their own rices
+func checkCanManageDiscussion(token *security.AccessToken, riceID string) error {
+	if token.IsAdmin {
+		return nil
+	}
+
+	isAuthor, err := repository.HasUserRiceWithId(riceID, token.Subject)
+	if err != nil || !isAuthor {
+		return errs.NoAccess
+	}
+
+	return nil
+}
+
+// Finds comment from the path parameter and makes sure the caller can moderate it as the rice author
+func findManagedComment(c *gin.Context, token *security.AccessToken) (*models.RiceCommentWithSlug, error) {
+	var path commentsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		return nil, invalidCommentId
+	}
+
+	comment, err := repository.FindCommentById(path.CommentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, commentNotFound
+		}
+
+		return nil, errs.InternalError(err)
+	}
+
+	if !token.IsAdmin && comment.RiceAuthorID.String() != token.Subject {
+		return nil, errs.NoAccess
+	}
+
+	return &comment, nil
+}
+
+// Saves users mentioned in the comment and notifies those mentioned for the first time.
+// Comment is already saved at this point so failures are only logged.
+func saveMentions(authorID string, comment models.RiceComment) {
+	commentID := comment.ID.String()
+	riceID := comment.RiceID.String()
+
+	added, err := repository.ReplaceCommentMentions(commentID, utils.ParseMentions(comment.Content))
+	if err != nil {
+		zap.L().Error("Failed to save comment mentions", zap.String("commentId", commentID), zap.Error(err))
+		return
+	}
+
+	for _, userID := range added {
+		notify(userID, notification{Type: models.MentionNotification, ActorID: &authorID, RiceID: &riceID, CommentID: &commentID})
+	}
+}
+
 func AddComment(c *gin.Context) {
 	token := c.MustGet("token").(*security.AccessToken)
 	if err := security.VerifyUserID(token.Subject); err != nil {
 		c.Error(err)
 		return
 	}
+	if err := security.VerifyRestriction(token.Subject, models.CommentRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	var body models.AddCommentDTO
 	if err := utils.ValidateJSON(c, &body); err != nil {
@@ -47,7 +176,40 @@ func AddComment(c *gin.Context) {
 		return
 	}
 
-	comment, err := repository.InsertComment(body.RiceID, token.Subject, body.Content)
+	var check contentCheck
+	if err := check.filter(&body.Content, blacklistedComment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := checkCanViewRice(token, body.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	parent, depth, err := checkCanReplyTo(body.ParentID, body.RiceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	locked, err := repository.AreCommentsLocked(body.RiceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(errs.RiceNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+	// moderators can still comment on locked rices
+	if locked && !token.IsAdmin {
+		c.Error(commentsLocked)
+		return
+	}
+
+	comment, err := repository.InsertComment(body.RiceID, token.Subject, body.ParentID, depth, body.Content)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
@@ -59,28 +221,61 @@ func AddComment(c *gin.Context) {
 		return
 	}
 
+	commentID := comment.ID.String()
+	check.report(models.CommentTarget, repository.ReportTargetIDs{CommentID: &commentID})
+	saveMentions(token.Subject, comment)
+
+	// rice author is notified about every comment so replying to them would notify them twice
+	n := notification{Type: models.CommentNotification, ActorID: &token.Subject, RiceID: &body.RiceID, CommentID: &commentID}
+	if parent != nil {
+		n.Type = models.ReplyNotification
+		notify(parent.AuthorID.String(), n)
+	}
+	if parent == nil || parent.RiceAuthorID != parent.AuthorID {
+		n.Type = models.CommentNotification
+		notifyRiceAuthor(body.RiceID, n)
+	}
+	publishNewComment(body.RiceID, commentID)
+
 	c.JSON(http.StatusCreated, comment.ToDTO())
 }
 
 func GetRecentComments(c *gin.Context) {
+	pag, err := bindCommentPagination(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	var query struct {
-		Limit int `form:"limit,default=20"`
+		Limit int `form:"limit,default=20" binding:"min=1,max=100"`
 	}
 	if err := c.ShouldBindQuery(&query); err != nil {
-		c.Error(errs.UserError("Failed to parse limit query parameter", http.StatusBadRequest))
+		c.Error(errs.UserError("Limit query parameter must be a number between 1 and 100", http.StatusBadRequest))
+		return
+	}
+
+	comments, err := repository.FetchRecentComments(pag, query.Limit)
+	if err != nil {
+		c.Error(errs.InternalError(err))
 		return
 	}
 
-	comments, err := repository.FetchRecentComments(query.Limit)
+	total, err := repository.FetchCommentCount()
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.CommentsWithUserToDTO(comments))
+	c.JSON(http.StatusOK, gin.H{
+		"totalCount": total,
+		"comments":   models.CommentsWithUserToDTO(comments),
+	})
 }
 
 func GetCommentById(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
 	var path commentsPath
 	if err := c.ShouldBindUri(&path); err != nil {
 		c.Error(invalidCommentId)
@@ -90,7 +285,7 @@ func GetCommentById(c *gin.Context) {
 	comment, err := repository.FindCommentById(path.CommentID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			c.Error(errs.UserError("Comment with provided ID not found", http.StatusNotFound))
+			c.Error(commentNotFound)
 			return
 		}
 
@@ -98,6 +293,20 @@ func GetCommentById(c *gin.Context) {
 		return
 	}
 
+	// hidden comments are visible only to their authors and moderators
+	if comment.IsHidden && !token.IsAdmin && comment.AuthorID.String() != token.Subject {
+		c.Error(commentNotFound)
+		return
+	}
+	if comment.DeletedAt != nil && !token.IsAdmin {
+		c.Error(commentNotFound)
+		return
+	}
+	if comment.HiddenByRiceAuthor && !token.IsAdmin && comment.AuthorID.String() != token.Subject && comment.RiceAuthorID.String() != token.Subject {
+		c.Error(commentNotFound)
+		return
+	}
+
 	c.JSON(http.StatusOK, comment.ToDTO())
 }
 
@@ -125,15 +334,211 @@ func UpdateComment(c *gin.Context) {
 		return
 	}
 
-	comment, err := repository.UpdateComment(path.CommentID, update.Content)
+	var check contentCheck
+	if err := check.filter(&update.Content, blacklistedComment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := repository.UpdateComment(path.CommentID, token.Subject, update.Content)
 	if err != nil {
+		// deleted comments can't be edited
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(commentNotFound)
+			return
+		}
+
 		c.Error(errs.InternalError(err))
 		return
 	}
 
+	check.report(models.CommentTarget, repository.ReportTargetIDs{CommentID: &path.CommentID})
+	saveMentions(comment.AuthorID.String(), comment)
+
 	c.JSON(http.StatusOK, comment.ToDTO())
 }
 
+// Shows every revision of the comment, including deleted ones
+func GetCommentHistory(c *gin.Context) {
+	var path commentsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidCommentId)
+		return
+	}
+
+	comment, err := repository.FindCommentById(path.CommentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(commentNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	revisions, err := repository.FetchCommentRevisions(path.CommentID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if comment.DeletedAt != nil {
+		*comment.DeletedAt = comment.DeletedAt.UTC()
+	}
+
+	c.JSON(http.StatusOK, models.CommentHistoryDTO{
+		Comment:   comment.ToDTO(),
+		DeletedAt: comment.DeletedAt,
+		DeletedBy: comment.DeletedBy,
+		Revisions: models.CommentRevisionsToDTO(revisions),
+	})
+}
+
+// Brings back automatically hidden comment and dismisses reports against it
+func RestoreComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path commentsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidCommentId)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	restored, err := repository.RestoreComment(tx, path.CommentID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !restored {
+		c.Error(errs.UserError("Hidden comment with provided ID not found", http.StatusNotFound))
+		return
+	}
+
+	if err := repository.DismissOpenReports(tx, models.CommentTarget, path.CommentID, token.Subject, "Comment restored by moderator"); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func PinComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := findManagedComment(c, token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if comment.ParentID != nil {
+		c.Error(errs.UserError("Only top level comments can be pinned", http.StatusUnprocessableEntity))
+		return
+	}
+	if comment.IsHidden || comment.HiddenByRiceAuthor || comment.DeletedAt != nil {
+		c.Error(errs.UserError("Hidden or deleted comment can't be pinned", http.StatusConflict))
+		return
+	}
+
+	if err := repository.PinComment(comment.RiceID.String(), comment.ID.String()); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func UnpinComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := findManagedComment(c, token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := repository.UnpinComment(comment.ID.String()); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Hides the comment from everyone except its author and the rice author
+func HideRiceComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := findManagedComment(c, token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if comment.DeletedAt != nil {
+		c.Error(commentNotFound)
+		return
+	}
+
+	if err := repository.SetCommentHiddenByRiceAuthor(comment.ID.String(), true); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	// hidden comment shouldn't stay on top of the discussion
+	if err := repository.UnpinComment(comment.ID.String()); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func UnhideRiceComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := findManagedComment(c, token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := repository.SetCommentHiddenByRiceAuthor(comment.ID.String(), false); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func DeleteComment(c *gin.Context) {
 	token := c.MustGet("token").(*security.AccessToken)
 	if err := security.VerifyUserID(token.Subject); err != nil {
@@ -152,7 +557,78 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	if err := repository.DeleteComment(path.CommentID); err != nil {
+	if err := repository.DeleteComment(path.CommentID, token.Subject); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Sets caller's reaction on the comment, replacing the previous one
+func ReactToComment(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyRestriction(token.Subject, models.ReactRestriction); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var path commentsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidCommentId)
+		return
+	}
+
+	var body models.ReactToCommentDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	comment, err := repository.FindCommentById(path.CommentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(commentNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+	// comments missing from the listings can't collect reactions
+	if comment.DeletedAt != nil || comment.IsHidden || comment.HiddenByRiceAuthor {
+		c.Error(commentNotFound)
+		return
+	}
+	if err := checkCanViewRice(token, comment.RiceID.String()); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := repository.UpsertCommentReaction(path.CommentID, token.Subject, models.CommentReaction(body.Reaction)); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			c.Error(commentNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+func DeleteCommentReaction(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path commentsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidCommentId)
+		return
+	}
+
+	if err := repository.DeleteCommentReaction(path.CommentID, token.Subject); err != nil {
 		c.Error(errs.InternalError(err))
 		return
 	}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// how many emails a single worker run sends at most
+const emailBatchSize = 20
+
+// how long a claimed email is reserved for the instance sending it
+const emailLease = 5 * time.Minute
+
+var emailTaken = errs.UserError("Email address is already in use", http.StatusConflict)
+var emailNotFound = errs.UserError("User doesn't have an email address", http.StatusNotFound)
+var invalidEmailToken = errs.UserError("This link is invalid or has expired", http.StatusBadRequest)
+
+// Emails are sent in the background so failures are only logged
+func queueEmail(recipient string, template string, data map[string]any) {
+	if err := repository.EnqueueEmail(recipient, template, data); err != nil {
+		zap.L().Error("Failed to queue email", zap.String("template", template), zap.Error(err))
+	}
+}
+
+// Sends queued emails in batches. It blocks so it should be run in a goroutine.
+func ProcessEmailQueue() {
+	ticker := time.NewTicker(utils.Config.Email.PollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// keep going while there are more emails waiting than fit in one batch
+		for sendQueuedEmails() == emailBatchSize {
+		}
+	}
+}
+
+// Returns how many emails were claimed
+func sendQueuedEmails() int {
+	emails, err := repository.ClaimPendingEmails(emailBatchSize, emailLease)
+	if err != nil {
+		zap.L().Error("Failed to claim queued emails", zap.Error(err))
+		return 0
+	}
+
+	for _, email := range emails {
+		emailID := email.ID.String()
+
+		err := deliverEmail(email)
+		if err == nil {
+			if err := repository.MarkEmailSent(emailID); err != nil {
+				zap.L().Error("Failed to mark email as sent", zap.String("emailId", emailID), zap.Error(err))
+			}
+			continue
+		}
+
+		// exponential backoff: retry_delay, 2 * retry_delay, 4 * retry_delay...
+		var retryAt *time.Time
+		if email.Attempts < utils.Config.Email.MaxAttempts {
+			delay := utils.Config.Email.RetryDelay * time.Duration(math.Pow(2, float64(email.Attempts-1)))
+			next := time.Now().Add(delay)
+			retryAt = &next
+		}
+
+		zap.L().Warn("Failed to send email",
+			zap.String("emailId", emailID),
+			zap.String("template", email.Template),
+			zap.Int("attempts", email.Attempts),
+			zap.Bool("willRetry", retryAt != nil),
+			zap.Error(err),
+		)
+
+		if err := repository.MarkEmailFailed(emailID, err.Error(), retryAt); err != nil {
+			zap.L().Error("Failed to mark email as failed", zap.String("emailId", emailID), zap.Error(err))
+		}
+	}
+
+	return len(emails)
+}
+
+func deliverEmail(email models.QueuedEmail) error {
+	msg, err := utils.RenderEmail(email.Recipient, email.Template, email.Data)
+	if err != nil {
+		return err
+	}
+
+	return utils.SendEmail(msg)
+}
+
+// Link to the frontend page that handles the token
+func emailLink(page string, token string) string {
+	return fmt.Sprintf("%v/%v?token=%v", strings.TrimSuffix(utils.Config.Email.LinksUrl, "/"), page, token)
+}
+
+// Sends a link confirming the user owns the address. Failures are only logged,
+// the user can always ask for another link.
+func sendEmailVerification(user *models.User, email string, template string) {
+	token, hash, err := security.NewOneTimeToken()
+	if err != nil {
+		zap.L().Error("Failed to generate email verification token", zap.Error(err))
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.Config.Email.VerificationExpiration)
+	if err := repository.InsertUserToken(user.ID.String(), models.EmailVerificationToken, hash, email, expiresAt); err != nil {
+		zap.L().Error("Failed to save email verification token", zap.String("userId", user.ID.String()), zap.Error(err))
+		return
+	}
+
+	queueEmail(email, template, map[string]any{
+		"username":    user.Username,
+		"displayName": user.DisplayName,
+		"link":        emailLink("verify-email", token),
+		"expiresIn":   utils.Config.Email.VerificationExpiration.String(),
+	})
+}
+
+func GetUserEmail(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	token := c.MustGet("token").(*security.AccessToken)
+	if _, err := preCheck(token, path.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	email, err := repository.FindUserEmail(path.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(emailNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, email.ToDTO())
+}
+
+// Returns current address of the user or nil if they don't have one
+func findUserEmail(userID string) (*models.UserEmail, error) {
+	email, err := repository.FindUserEmail(userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.InternalError(err)
+	}
+
+	return &email, nil
+}
+
+func UpdateUserEmail(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := preCheck(token, path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var body models.UpdateEmailDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// stolen access token alone shouldn't be enough to take over the account
+	if !token.IsAdmin {
+		match, err := argon2id.ComparePasswordAndHash(body.Password, user.Password)
+		if err != nil {
+			c.Error(errs.InternalError(err))
+			return
+		}
+		if !match {
+			c.Error(errs.UserError("Invalid password provided", http.StatusForbidden))
+			return
+		}
+	}
+
+	old, err := findUserEmail(path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// address taken by someone else is only rejected once it's verified
+	email, err := repository.UpsertUserEmail(path.UserID, body.Email)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if email.VerifiedAt == nil {
+		sendEmailVerification(user, email.Email, "verify_email")
+	}
+
+	// previous address is told about the change in case the account was taken over
+	if old != nil && old.Email != email.Email {
+		queueEmail(old.Email, "email_changed", map[string]any{
+			"username":    user.Username,
+			"displayName": user.DisplayName,
+			"newEmail":    email.Email,
+		})
+	}
+
+	c.JSON(http.StatusOK, email.ToDTO())
+}
+
+func DeleteUserEmail(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := preCheck(token, path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	old, err := findUserEmail(path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if old == nil {
+		c.Error(emailNotFound)
+		return
+	}
+
+	if _, err := repository.DeleteUserEmail(path.UserID); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	queueEmail(old.Email, "email_changed", map[string]any{
+		"username":    user.Username,
+		"displayName": user.DisplayName,
+	})
+
+	c.Status(http.StatusNoContent)
+}
+
+// Sends another verification link in case the previous one expired or got lost
+func ResendEmailVerification(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	token := c.MustGet("token").(*security.AccessToken)
+	user, err := preCheck(token, path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	email, err := findUserEmail(path.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if email == nil {
+		c.Error(emailNotFound)
+		return
+	}
+	if email.VerifiedAt != nil {
+		c.Error(errs.UserError("Email address is already verified", http.StatusConflict))
+		return
+	}
+
+	sendEmailVerification(user, email.Email, "verify_email")
+	c.Status(http.StatusAccepted)
+}
+
+func VerifyEmail(c *gin.Context) {
+	var body models.VerifyEmailDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	userToken, err := repository.ConsumeUserToken(tx, security.HashOneTimeToken(body.Token), models.EmailVerificationToken)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(invalidEmailToken)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// the address could've been changed after the link was sent
+	verified, err := repository.MarkEmailVerified(tx, userToken.UserID.String(), userToken.Email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			c.Error(emailTaken)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !verified {
+		c.Error(invalidEmailToken)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Lets moderators check the email configuration, e.g. against a local catcher like MailHog
+func SendTestEmail(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var body models.TestEmailDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := findUser(token.Subject)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := repository.EnqueueEmail(body.To, "test", map[string]any{"requestedBy": user.Username}); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
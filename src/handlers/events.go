@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// keeps proxies from closing idle streams
+const streamPingInterval = 30 * time.Second
+
+// Real-time events are best effort, clients can always fetch the current state themselves
+func publishEvent(topic string, eventType string, data any) {
+	if err := utils.PublishEvent(topic, eventType, data); err != nil {
+		zap.L().Warn("Failed to publish event", zap.String("topic", topic), zap.String("type", eventType), zap.Error(err))
+	}
+}
+
+// Pushes the comment to everyone viewing the rice unless it's hidden from the public
+func publishNewComment(riceID string, commentID string) {
+	comment, err := repository.FindPublicComment(commentID)
+	if err != nil {
+		zap.L().Error("Failed to fetch comment for the event", zap.String("commentId", commentID), zap.Error(err))
+		return
+	}
+	if comment == nil {
+		return
+	}
+
+	publishEvent(utils.RiceEventsTopic(riceID), "comment", comment.ToDTO())
+}
+
+func publishStarCount(riceID string) {
+	count, err := repository.FetchRiceStarCount(riceID)
+	if err != nil {
+		zap.L().Error("Failed to fetch star count for the event", zap.String("riceId", riceID), zap.Error(err))
+		return
+	}
+
+	publishEvent(utils.RiceEventsTopic(riceID), "stars", gin.H{"riceId": riceID, "starCount": count})
+}
+
+// Streams caller's notifications and, if riceId is provided, activity on the rice as Server-Sent Events
+func StreamEvents(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var query struct {
+		RiceID *string `form:"riceId" binding:"omitempty,uuid"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	topics := []string{utils.UserEventsTopic(token.Subject)}
+	if query.RiceID != nil {
+		rice, err := repository.FindRiceById(nil, *query.RiceID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.Error(errs.RiceNotFound)
+				return
+			}
+
+			c.Error(errs.InternalError(err))
+			return
+		}
+		if !canViewRice(token, rice) {
+			c.Error(errs.RiceNotFound)
+			return
+		}
+
+		topics = append(topics, utils.RiceEventsTopic(*query.RiceID))
+	}
+
+	events, unsubscribe := utils.SubscribeEvents(topics...)
+	defer unsubscribe()
+
+	// the stream is closed once the token expires so the client has to reconnect with a fresh one
+	var expired <-chan time.Time
+	if token.ExpiresAt != nil {
+		expired = time.After(time.Until(token.ExpiresAt.Time))
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// disables response buffering in nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case <-expired:
+			c.SSEvent("expired", gin.H{"message": "Access token expired, reconnect with a fresh one"})
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+type filterRulesPath struct {
+	RuleID string `uri:"id" binding:"required,uuid"`
+}
+
+var filterRuleNotFound = errs.UserError("Filter rule with provided ID not found", http.StatusNotFound)
+var filterRuleExists = errs.UserError("Filter rule with the same pattern already exists", http.StatusConflict)
+
+// Collects results of filtering multiple fields of the same resource
+type contentCheck struct {
+	flagged []string
+}
+
+// Runs the field through the content filter and replaces it with its masked version
+func (cc *contentCheck) filter(field *string, rejectErr error) error {
+	if field == nil {
+		return nil
+	}
+
+	res := security.FilterContent(*field)
+	if res.Rejected {
+		return rejectErr
+	}
+
+	*field = res.Text
+	if res.Flagged {
+		cc.flagged = append(cc.flagged, res.Matched...)
+	}
+
+	return nil
+}
+
+// Reports the resource for moderator review if any of its fields was flagged.
+// Content is already saved at this point so failures are only logged.
+func (cc *contentCheck) report(targetType models.ReportTarget, ids repository.ReportTargetIDs) {
+	if len(cc.flagged) == 0 {
+		return
+	}
+
+	reason := fmt.Sprintf("Automatically flagged by content filter. Matched rules: %v", strings.Join(cc.flagged, ", "))
+	if _, err := repository.InsertReport(nil, models.OtherViolation, reason, targetType, ids); err != nil {
+		zap.L().Error("Failed to report content flagged by the filter", zap.String("targetType", string(targetType)), zap.Error(err))
+	}
+}
+
+// Makes sure the rule compiles before it's saved
+func validateFilterRule(rule models.FilterRule) error {
+	if _, err := security.CompileFilterRule(rule); err != nil {
+		return errs.UserError(fmt.Sprintf("Invalid pattern: %v", err), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func FetchFilterRules(c *gin.Context) {
+	rules, err := repository.FetchFilterRules()
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FilterRulesToDTO(rules))
+}
+
+func CreateFilterRule(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var body models.CreateFilterRuleDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	rule := models.FilterRule{
+		Pattern:   body.Pattern,
+		Kind:      models.FilterRuleKind(body.Kind),
+		Action:    models.FilterAction(body.Action),
+		Normalize: body.Normalize == nil || *body.Normalize,
+	}
+	if err := validateFilterRule(rule); err != nil {
+		c.Error(err)
+		return
+	}
+
+	rule, err := repository.InsertFilterRule(rule.Pattern, rule.Kind, rule.Action, rule.Normalize, token.Subject)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			c.Error(filterRuleExists)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	security.NotifyContentFilterChange()
+	c.JSON(http.StatusCreated, rule.ToDTO())
+}
+
+func UpdateFilterRule(c *gin.Context) {
+	var path filterRulesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(errs.UserError("Invalid filter rule ID path parameter. It must be a valid UUID.", http.StatusBadRequest))
+		return
+	}
+
+	var body models.UpdateFilterRuleDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	rule, err := repository.FindFilterRule(path.RuleID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(filterRuleNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if body.Pattern != nil {
+		rule.Pattern = *body.Pattern
+	}
+	if body.Kind != nil {
+		rule.Kind = models.FilterRuleKind(*body.Kind)
+	}
+	if body.Action != nil {
+		rule.Action = models.FilterAction(*body.Action)
+	}
+	if body.Normalize != nil {
+		rule.Normalize = *body.Normalize
+	}
+	if err := validateFilterRule(rule); err != nil {
+		c.Error(err)
+		return
+	}
+
+	rule, err = repository.UpdateFilterRule(rule)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			c.Error(filterRuleExists)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	security.NotifyContentFilterChange()
+	c.JSON(http.StatusOK, rule.ToDTO())
+}
+
+func DeleteFilterRule(c *gin.Context) {
+	var path filterRulesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(errs.UserError("Invalid filter rule ID path parameter. It must be a valid UUID.", http.StatusBadRequest))
+		return
+	}
+
+	deleted, err := repository.DeleteFilterRule(path.RuleID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !deleted {
+		c.Error(filterRuleNotFound)
+		return
+	}
+
+	security.NotifyContentFilterChange()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// banning bigger networks would most likely lock out a lot of innocent users
+const minIPv4PrefixBits = 8
+const minIPv6PrefixBits = 32
+
+// Accepts single address or network in CIDR notation and returns it as a network
+func parseNetwork(network string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		addr, err := netip.ParseAddr(network)
+		if err != nil {
+			return netip.Prefix{}, errs.UserError("Invalid IP address or network", http.StatusBadRequest)
+		}
+
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	minBits := minIPv6PrefixBits
+	if prefix.Addr().Is4() {
+		minBits = minIPv4PrefixBits
+	}
+	if prefix.Bits() < minBits {
+		return netip.Prefix{}, errs.UserError("Network is too broad to be banned", http.StatusBadRequest)
+	}
+
+	return prefix.Masked(), nil
+}
+
+func FetchIPBans(c *gin.Context) {
+	bans, err := repository.FetchActiveIPBans()
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.IPBansToDTO(bans))
+}
+
+// Newest login lockouts, useful for spotting addresses worth banning
+func FetchLoginLockouts(c *gin.Context) {
+	lockouts, err := repository.FetchLoginLockouts(utils.Config.PaginationLimit)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginLockoutsToDTO(lockouts))
+}
+
+func CreateIPBan(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var body models.CreateIPBanDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	network, err := parseNetwork(body.Network)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// make sure admin doesn't lock themselves out
+	if clientIP, err := netip.ParseAddr(c.ClientIP()); err == nil && network.Contains(clientIP.Unmap()) {
+		c.Error(errs.UserError("You cannot ban your own network", http.StatusBadRequest))
+		return
+	}
+
+	expiresAt, err := computeExpiration(body.Duration)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ban, err := repository.InsertIPBan(network.String(), token.Subject, body.Reason, expiresAt)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, ban.ToDTO())
+}
+
+func DeleteIPBan(c *gin.Context) {
+	var path struct {
+		BanID string `uri:"id" binding:"required,uuid"`
+	}
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(errs.UserError("Invalid ban ID path parameter. It must be a valid UUID.", http.StatusBadRequest))
+		return
+	}
+
+	deleted, err := repository.DeleteIPBan(path.BanID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !deleted {
+		c.Error(errs.UserError("IP ban with provided ID not found", http.StatusNotFound))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Shows addresses used by the user and other accounts that share them
+func GetUserNetwork(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	if _, err := findUser(path.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// users registered before addresses were recorded simply have none
+	ips, err := repository.FindUserIPs(path.UserID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	linked, err := repository.FetchLinkedAccounts(path.UserID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewUserNetworkDTO(ips, linked))
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var riceClaimedByOther = errs.UserError("This rice is currently being reviewed by another moderator", http.StatusConflict)
+var riceNotInQueue = errs.UserError("This rice is not waiting for a review", http.StatusConflict)
+
+// Finds the rice and makes sure it's still in the moderation queue
+func findQueuedRice(riceID string) (*models.Rice, error) {
+	rice, err := repository.FindRiceById(nil, riceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errs.RiceNotFound
+		}
+
+		return nil, errs.InternalError(err)
+	}
+
+	if rice.Rice.State != models.Waiting {
+		return nil, riceNotInQueue
+	}
+
+	return &rice.Rice, nil
+}
+
+func FetchModerationQueue(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var query struct {
+		MinAge          string    `form:"minAge"`
+		MaxAge          string    `form:"maxAge"`
+		Unclaimed       bool      `form:"unclaimed"`
+		LastID          *string   `form:"lastId" binding:"omitempty,uuid"`
+		LastSubmittedAt time.Time `form:"lastSubmittedAt"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Error(errs.UserError("Failed to parse query parameters", http.StatusBadRequest))
+		return
+	}
+
+	filter := repository.QueueFilter{
+		LastID:          query.LastID,
+		LastSubmittedAt: query.LastSubmittedAt,
+	}
+
+	// ages are durations, e.g. `minAge=24h` shows rices waiting for at least a day
+	now := time.Now()
+	if query.MinAge != "" {
+		age, err := time.ParseDuration(query.MinAge)
+		if err != nil {
+			c.Error(errs.UserError("Failed to parse minAge duration", http.StatusBadRequest))
+			return
+		}
+		before := now.Add(-age)
+		filter.SubmittedBefore = &before
+	}
+	if query.MaxAge != "" {
+		age, err := time.ParseDuration(query.MaxAge)
+		if err != nil {
+			c.Error(errs.UserError("Failed to parse maxAge duration", http.StatusBadRequest))
+			return
+		}
+		after := now.Add(-age)
+		filter.SubmittedAfter = &after
+	}
+	if query.Unclaimed {
+		filter.UnclaimedFor = &token.Subject
+	}
+
+	rices, err := repository.FetchModerationQueue(&filter)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	total, err := repository.CountModerationQueue(&filter)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"rices": models.QueuedRicesToDTO(rices),
+	})
+}
+
+func ClaimRice(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	if _, err := findQueuedRice(path.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.Config.Moderation.ClaimDuration)
+	claim, err := repository.ClaimRice(path.RiceID, token.Subject, expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(riceClaimedByOther)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, claim.ToDTO())
+}
+
+func ReleaseRiceClaim(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	released, err := repository.ReleaseClaim(path.RiceID, token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !released {
+		c.Error(errs.UserError("You haven't claimed this rice", http.StatusNotFound))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetReviewNotes(c *gin.Context) {
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	notes, err := repository.FetchReviewNotes(path.RiceID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ReviewNotesToDTO(notes))
+}
+
+func AddReviewNote(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	var body models.ReviewNoteBodyDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	note, err := repository.InsertReviewNote(path.RiceID, token.Subject, body.Content)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			c.Error(errs.RiceNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, note.ToDTO())
+}
+
+func ApproveRice(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	rice, err := findQueuedRice(path.RiceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := changeRiceState(token, *rice, models.Accepted, nil); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func RejectRice(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	var body models.RejectRiceDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	rice, err := findQueuedRice(path.RiceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := changeRiceState(token, *rice, models.Rejected, &body.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
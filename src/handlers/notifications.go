@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/security"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type notificationsPath struct {
+	NotificationID string `uri:"id" binding:"required,uuid"`
+}
+
+var notificationNotFound = errs.UserError("Notification with provided ID not found", http.StatusNotFound)
+
+type notification struct {
+	Type models.NotificationType
+	// user who caused the event, nil for anonymous and moderation events
+	ActorID   *string
+	RiceID    *string
+	CommentID *string
+	Data      map[string]any
+	// skip if the same notification is still unread
+	Dedupe bool
+}
+
+// Notifications are side effects of other actions so failures are only logged
+func notify(userID string, n notification) {
+	if n.ActorID != nil {
+		// nobody has to be notified about their own actions
+		if *n.ActorID == userID {
+			return
+		}
+
+		// actions of shadow banned users are invisible to others so they can't ping anyone
+		state, err := repository.IsUserBanned(*n.ActorID, models.ShadowBan)
+		if err != nil || state.UserBanned {
+			return
+		}
+	}
+
+	created, err := repository.InsertNotification(userID, n.Type, n.ActorID, n.RiceID, n.CommentID, n.Data, n.Dedupe)
+	if err != nil {
+		// skipped because of user's preferences or a duplicate
+		if errors.Is(err, pgx.ErrNoRows) {
+			return
+		}
+
+		zap.L().Error("Failed to create notification",
+			zap.String("userId", userID),
+			zap.String("type", string(n.Type)),
+			zap.Error(err),
+		)
+		return
+	}
+
+	publishEvent(utils.UserEventsTopic(userID), "notification", created.ToDTO())
+}
+
+// Notifies author of the rice, the caller has to make sure the rice exists
+func notifyRiceAuthor(riceID string, n notification) {
+	authorID, err := repository.FindRiceAuthorID(riceID)
+	if err != nil {
+		zap.L().Error("Failed to find rice author to notify", zap.String("riceId", riceID), zap.Error(err))
+		return
+	}
+
+	n.RiceID = &riceID
+	notify(authorID, n)
+}
+
+func GetNotifications(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var query struct {
+		Unread        bool       `form:"unread"`
+		LastID        *string    `form:"lastId" binding:"omitempty,uuid"`
+		LastCreatedAt *time.Time `form:"lastCreatedAt"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Error(errs.UserError("Failed to parse query parameters", http.StatusBadRequest))
+		return
+	}
+	if (query.LastID == nil) != (query.LastCreatedAt == nil) {
+		c.Error(errs.UserError("lastId and lastCreatedAt have to be provided together", http.StatusBadRequest))
+		return
+	}
+
+	notifications, err := repository.FetchNotifications(token.Subject, query.Unread, query.LastID, query.LastCreatedAt)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	unread, err := repository.FetchUnreadNotificationCount(token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": models.NotificationsToDTO(notifications),
+		"unreadCount":   unread,
+	})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path notificationsPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(errs.UserError("Invalid notification ID path parameter. It must be a valid UUID.", http.StatusBadRequest))
+		return
+	}
+
+	found, err := repository.MarkNotificationRead(path.NotificationID, token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !found {
+		c.Error(notificationNotFound)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	marked, err := repository.MarkAllNotificationsRead(token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"markedCount": marked})
+}
+
+func GetNotificationPreferences(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	prefs, err := repository.FetchNotificationPreferences(token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": models.NotificationPreferencesToDTO(prefs)})
+}
+
+func UpdateNotificationPreferences(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var body models.UpdateNotificationPreferencesDTO
+	if err := utils.ValidateJSON(c, &body); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// the same type can't be upserted twice in one query, the last one wins
+	enabled := make(map[models.NotificationType]bool, len(body.Preferences))
+	for _, p := range body.Preferences {
+		enabled[p.Type] = *p.Enabled
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(enabled))
+	for notifType, on := range enabled {
+		prefs = append(prefs, models.NotificationPreference{Type: notifType, Enabled: on})
+	}
+
+	if err := repository.UpdateNotificationPreferences(token.Subject, prefs); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	updated, err := repository.FetchNotificationPreferences(token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": models.NotificationPreferencesToDTO(updated)})
+}
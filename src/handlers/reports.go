@@ -1,24 +1,182 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"os"
 	"ricehub/src/errs"
 	"ricehub/src/models"
 	"ricehub/src/repository"
 	"ricehub/src/security"
 	"ricehub/src/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 )
 
 var reportNotFound = errs.UserError("Report with provided ID not found!", http.StatusNotFound)
 
+// Parses report list filters and cursors from query parameters
+func bindReportFilter(c *gin.Context) (*repository.ReportFilter, error) {
+	var query struct {
+		Status          *string   `form:"status" binding:"omitempty,oneof=open in_review resolved dismissed"`
+		Category        *string   `form:"category" binding:"omitempty,oneof=spam stolen_content nsfw malware harassment other"`
+		TargetType      *string   `form:"targetType" binding:"omitempty,oneof=rice comment user preview"`
+		From            time.Time `form:"from"`
+		To              time.Time `form:"to"`
+		LastID          *string   `form:"lastId" binding:"omitempty,uuid"`
+		LastCreatedAt   time.Time `form:"lastCreatedAt"`
+		LastTargetID    *string   `form:"lastTargetId" binding:"omitempty,uuid"`
+		LastReportCount *int      `form:"lastReportCount" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return nil, errs.UserError("Failed to parse query parameters", http.StatusBadRequest)
+	}
+
+	// grouped list cursor is useless without either of its parts
+	if (query.LastTargetID == nil) != (query.LastReportCount == nil) {
+		return nil, errs.UserError("Both lastTargetId and lastReportCount are required to fetch the next page", http.StatusBadRequest)
+	}
+
+	filter := repository.ReportFilter{
+		Status:        query.Status,
+		Category:      query.Category,
+		TargetType:    query.TargetType,
+		LastID:        query.LastID,
+		LastCreatedAt: query.LastCreatedAt,
+		LastTargetID:  query.LastTargetID,
+	}
+	if query.LastReportCount != nil {
+		filter.LastReportCount = *query.LastReportCount
+	}
+	if !query.From.IsZero() {
+		filter.From = &query.From
+	}
+	if !query.To.IsZero() {
+		filter.To = &query.To
+	}
+
+	return &filter, nil
+}
+
+const autoHideReason = "Automatically hidden after being reported by multiple users. Waiting for moderator review."
+
+// Hides reported rice or comment pending review once enough users have reported it
+func autoHideReportedContent(targetType models.ReportTarget, targetID string) error {
+	threshold := utils.Config.Moderation.AutoHideThreshold
+	if threshold <= 0 || (targetType != models.RiceTarget && targetType != models.CommentTarget) {
+		return nil
+	}
+
+	score, err := repository.FetchReportScore(targetType, targetID, utils.Config.Moderation.ReporterFullWeightAge)
+	if err != nil {
+		return err
+	}
+	if score < threshold {
+		return nil
+	}
+
+	hidden := false
+	switch targetType {
+	case models.RiceTarget:
+		ctx := context.Background()
+		tx, err := repository.StartTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(context.Background())
+
+		hidden, err = repository.HideAcceptedRice(tx, targetID, autoHideReason)
+		if err != nil {
+			return err
+		}
+		if hidden {
+			reason := autoHideReason
+			if err := repository.InsertRiceStateChange(tx, targetID, nil, models.Accepted, models.Hidden, &reason); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+	case models.CommentTarget:
+		hidden, err = repository.HideComment(targetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hidden {
+		zap.L().Info("Reported content has been automatically hidden",
+			zap.String("targetType", string(targetType)),
+			zap.String("targetId", targetID),
+			zap.Float64("score", score),
+		)
+	}
+
+	return nil
+}
+
+// Resolves the report and deletes reported preview in one go. The file is removed only
+// after the transaction is committed so a failed update doesn't leave the rice without it.
+func resolveByRemovingPreview(report models.ReportWithUser, handledBy string, note *string, action *models.ReportAction) error {
+	count, err := repository.FetchRicePreviewCount(report.RiceID.String())
+	if err != nil {
+		return errs.InternalError(err)
+	}
+	if count <= 1 {
+		return errs.UserError("This is the only preview of the rice! Hide the rice instead.", http.StatusUnprocessableEntity)
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		return errs.InternalError(err)
+	}
+	defer tx.Rollback(context.Background())
+
+	updated, err := repository.UpdateOpenReportStatus(tx, report.ID.String(), models.ReportResolved, handledBy, note, action)
+	if err != nil {
+		return errs.InternalError(err)
+	}
+	if !updated {
+		return errs.UserError("Report has already been closed", http.StatusConflict)
+	}
+
+	// preview could've been deleted by its author in the meantime
+	filePath, err := repository.DeleteRicePreviewById(tx, report.PreviewID.String())
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errs.InternalError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errs.InternalError(err)
+	}
+
+	if filePath != "" {
+		path := "./public" + filePath
+		if err := os.Remove(path); err != nil {
+			zap.L().Warn("Failed to remove reported preview from storage", zap.String("path", path))
+		}
+	}
+
+	return nil
+}
+
 func FetchReports(c *gin.Context) {
-	reports, err := repository.FetchReports()
+	filter, err := bindReportFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reports, err := repository.FetchReports(filter)
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
@@ -27,6 +185,23 @@ func FetchReports(c *gin.Context) {
 	c.JSON(http.StatusOK, models.ReportsToDTO(reports))
 }
 
+// Lists every reported resource once, most reported first
+func FetchReportedTargets(c *gin.Context) {
+	filter, err := bindReportFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	targets, err := repository.FetchReportedTargets(filter)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ReportedTargetsToDTO(targets))
+}
+
 func GetReportById(c *gin.Context) {
 	reportID := c.Param("reportId")
 	report, err := repository.FindReport(reportID)
@@ -45,6 +220,10 @@ func GetReportById(c *gin.Context) {
 
 func CreateReport(c *gin.Context) {
 	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyRestriction(token.Subject, models.ReportRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	var report models.CreateReportDTO
 	if err := utils.ValidateJSON(c, &report); err != nil {
@@ -52,17 +231,49 @@ func CreateReport(c *gin.Context) {
 		return
 	}
 
-	if report.RiceID != nil && report.CommentID != nil {
+	// figure out what is being reported
+	targets := map[models.ReportTarget]*string{
+		models.RiceTarget:    report.RiceID,
+		models.CommentTarget: report.CommentID,
+		models.UserTarget:    report.UserID,
+		models.PreviewTarget: report.PreviewID,
+	}
+	var targetType models.ReportTarget
+	provided := 0
+	for t, id := range targets {
+		if id != nil {
+			targetType = t
+			provided++
+		}
+	}
+	if provided == 0 {
+		c.Error(errs.UserError("No resource to report provided!", http.StatusBadRequest))
+		return
+	}
+	if provided > 1 {
 		c.Error(errs.UserError("Too many resources provided! You can only report one thing at a time.", http.StatusBadRequest))
 		return
 	}
 
-	reportId, err := repository.InsertReport(token.Subject, report.Reason, report.RiceID, report.CommentID)
+	if report.UserID != nil && *report.UserID == token.Subject {
+		c.Error(errs.UserError("You cannot report yourself", http.StatusBadRequest))
+		return
+	}
+
+	category := models.ReportCategory(report.Category)
+	ids := repository.ReportTargetIDs{
+		RiceID:    report.RiceID,
+		CommentID: report.CommentID,
+		UserID:    report.UserID,
+		PreviewID: report.PreviewID,
+	}
+	reportId, err := repository.InsertReport(&token.Subject, category, report.Reason, targetType, ids)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			switch pgErr.Code {
-			case pgerrcode.ForeignKeyViolation:
+			// check violation happens when reported preview doesn't exist (its rice id can't be found)
+			case pgerrcode.ForeignKeyViolation, pgerrcode.CheckViolation:
 				c.Error(errs.UserError("Resource with provided ID not found!", http.StatusNotFound))
 				return
 			case pgerrcode.UniqueViolation:
@@ -75,13 +286,73 @@ func CreateReport(c *gin.Context) {
 		return
 	}
 
+	// report itself is already saved so failing to hide the content shouldn't fail the request
+	if err := autoHideReportedContent(targetType, *targets[targetType]); err != nil {
+		zap.L().Error("Failed to automatically hide reported content", zap.Error(err))
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"reportId": reportId})
 }
 
-func CloseReport(c *gin.Context) {
+func UpdateReport(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
 	reportID := c.Param("reportId")
 
-	updated, err := repository.SetReportIsClosed(reportID, true)
+	var update models.UpdateReportDTO
+	if err := utils.ValidateJSON(c, &update); err != nil {
+		c.Error(err)
+		return
+	}
+
+	status := models.ReportStatus(update.Status)
+
+	// closed reports must say what has been done about them
+	var action *models.ReportAction
+	if update.ActionTaken != nil {
+		a := models.ReportAction(*update.ActionTaken)
+		action = &a
+	}
+	switch status {
+	case models.ReportResolved:
+		if action == nil {
+			c.Error(errs.UserError("Action taken is required when resolving a report", http.StatusBadRequest))
+			return
+		}
+	case models.ReportDismissed:
+		if action != nil && *action != models.NoAction {
+			c.Error(errs.UserError("Dismissed report cannot have any action taken", http.StatusBadRequest))
+			return
+		}
+		none := models.NoAction
+		action = &none
+	default:
+		action = nil
+	}
+
+	report, err := repository.FindReport(reportID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(reportNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// offensive screenshot can be removed without touching the rest of the rice
+	if report.TargetType == models.PreviewTarget && report.PreviewID != nil &&
+		status == models.ReportResolved && *action == models.ContentRemoved {
+		if err := resolveByRemovingPreview(report, token.Subject, update.ResolutionNote, action); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	updated, err := repository.UpdateReportStatus(reportID, status, token.Subject, update.ResolutionNote, action)
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
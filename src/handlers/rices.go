@@ -49,14 +49,125 @@ func checkCanUserModifyRice(token *security.AccessToken, riceID string) error {
 	return nil
 }
 
-func fetchWaitingRices(c *gin.Context) {
-	rices, err := repository.FetchWaitingRices()
+// Compares the preview against previews of other authors and flags it for moderators if it's a near-duplicate
+func flagDuplicatePreviews(tx pgx.Tx, preview models.RicePreview) error {
+	if preview.PHash == nil {
+		return nil
+	}
+
+	found, err := repository.FlagDuplicatePreviews(tx, preview.ID)
 	if err != nil {
-		c.Error(errs.InternalError(err))
-		return
+		return err
+	}
+
+	if found > 0 {
+		zap.L().Info("Uploaded preview looks like a duplicate of other author's preview",
+			zap.String("riceId", preview.RiceID.String()),
+			zap.String("previewId", preview.ID.String()),
+			zap.Int64("duplicates", found),
+		)
+	}
+
+	return nil
+}
+
+// Checks whether the caller can see the rice. Non-public rices and rices of shadow banned users
+// are visible only to their authors and admins.
+func canViewRice(token *security.AccessToken, rice models.RiceWithRelations) bool {
+	if rice.Rice.State.IsPublic() && !rice.AuthorShadowBanned {
+		return true
+	}
+
+	return token != nil && (token.IsAdmin || token.Subject == rice.Rice.AuthorID.String())
+}
+
+// Interactions (comments, stars, reactions) are allowed only on rices the caller can see
+func checkCanViewRice(token *security.AccessToken, riceID string) error {
+	rice, err := repository.FindRiceById(nil, riceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errs.RiceNotFound
+		}
+
+		return errs.InternalError(err)
+	}
+
+	if !canViewRice(token, rice) {
+		return errs.RiceNotFound
+	}
+
+	return nil
+}
+
+// Moves the rice to a new state (if the caller is allowed to) and records the change in the state history
+func changeRiceState(token *security.AccessToken, rice models.Rice, newState models.RiceState, reason *string) error {
+	riceID := rice.ID.String()
+	oldState := rice.State
+	if !oldState.CanTransitionTo(newState, token.IsAdmin) {
+		return errs.UserError(fmt.Sprintf("Rice cannot be moved from '%v' to '%v' state", oldState, newState), http.StatusConflict)
+	}
+
+	// author has to know what to fix before resubmitting
+	if (newState == models.Rejected || newState == models.Hidden) && reason == nil {
+		return errs.UserError("Reason is required when rejecting or hiding a rice", http.StatusBadRequest)
+	}
+
+	// make sure moderators don't review the rice someone else is working on
+	if oldState == models.Waiting && token.IsAdmin {
+		claim, err := repository.FindActiveClaim(riceID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return errs.InternalError(err)
+		}
+		if err == nil && claim.ModeratorID.String() != token.Subject {
+			return riceClaimedByOther
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		return errs.InternalError(err)
 	}
+	defer tx.Rollback(context.Background())
 
-	c.JSON(http.StatusOK, models.PartialRicesToDTO(rices))
+	// the state was checked before the transaction so it has to be still the same
+	updated, err := repository.UpdateRiceState(tx, riceID, oldState, newState, reason)
+	if err != nil {
+		return errs.InternalError(err)
+	}
+	if !updated {
+		return errs.UserError("Rice state has been changed in the meantime, please refresh and try again", http.StatusConflict)
+	}
+	if err := repository.InsertRiceStateChange(tx, riceID, &token.Subject, oldState, newState, reason); err != nil {
+		return errs.InternalError(err)
+	}
+	if oldState == models.Waiting {
+		if err := repository.DeleteRiceClaim(tx, riceID); err != nil {
+			return errs.InternalError(err)
+		}
+	}
+	// restoring hidden rice means reports against it were not valid
+	if oldState == models.Hidden && newState == models.Accepted && token.IsAdmin {
+		if err := repository.DismissOpenReports(tx, models.RiceTarget, riceID, token.Subject, "Rice restored by moderator"); err != nil {
+			return errs.InternalError(err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errs.InternalError(err)
+	}
+
+	// moderators stay anonymous, authors only learn the decision and the reason
+	if token.Subject != rice.AuthorID.String() && (newState == models.Accepted || newState == models.Rejected) {
+		n := notification{Type: models.RiceAcceptedNotification, RiceID: &riceID}
+		if newState == models.Rejected {
+			n.Type = models.RiceRejectedNotification
+			n.Data = map[string]any{"reason": *reason}
+		}
+		notify(rice.AuthorID.String(), n)
+	}
+
+	return nil
 }
 
 func FetchRices(c *gin.Context) {
@@ -82,7 +193,9 @@ func FetchRices(c *gin.Context) {
 
 	// check if user is an admin and can filter by state
 	if query.State != "" && isAdmin {
-		fetchWaitingRices(c)
+		// route isn't behind auth middleware so the token has to be provided manually
+		c.Set("token", token)
+		FetchModerationQueue(c)
 		return
 	}
 
@@ -166,7 +279,7 @@ func GetRiceById(c *gin.Context) {
 		return
 	}
 
-	if rice.Rice.State == models.Waiting && (token == nil || !token.IsAdmin) {
+	if !canViewRice(token, rice) {
 		c.Error(errs.RiceNotFound)
 		return
 	}
@@ -181,13 +294,136 @@ func GetRiceComments(c *gin.Context) {
 		return
 	}
 
-	comments, err := repository.FetchCommentsByRiceId(path.RiceID)
+	pag, err := bindCommentPagination(c)
 	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var query struct {
+		Nested bool `form:"nested"`
+		// jumps to the page containing this comment, used for deep links
+		CommentID *string `form:"commentId" binding:"omitempty,uuid"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Error(errs.UserError("Failed to parse query parameters", http.StatusBadRequest))
+		return
+	}
+
+	token := GetTokenFromRequest(c)
+	if err := checkCanViewRice(token, path.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var userID *string = nil
+	if token != nil {
+		userID = &token.Subject
+	}
+
+	locked, err := repository.AreCommentsLocked(path.RiceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(errs.RiceNotFound)
+			return
+		}
+
 		c.Error(errs.InternalError(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.CommentsWithUserToDTO(comments))
+	res := gin.H{"locked": locked}
+
+	if query.CommentID != nil {
+		pos, err := repository.FetchCommentPosition(path.RiceID, userID, *query.CommentID, pag.Sort)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.Error(commentNotFound)
+				return
+			}
+
+			c.Error(errs.InternalError(err))
+			return
+		}
+
+		limit := int(utils.Config.PaginationLimit)
+		pag.Offset = pos - pos%limit
+		pag.LastID = nil
+		res["page"] = pos/limit + 1
+	}
+
+	comments, err := repository.FetchCommentsByRiceId(path.RiceID, userID, pag)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	total, topLevel, err := repository.FetchRiceCommentCount(path.RiceID, userID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	pinned, err := repository.FindPinnedComment(path.RiceID, userID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	res["pinned"] = nil
+	if pinned != nil {
+		res["pinned"] = pinned.ToDTO()
+	}
+
+	res["totalCount"] = total
+	res["pageCount"] = (topLevel + int(utils.Config.PaginationLimit) - 1) / int(utils.Config.PaginationLimit)
+	if query.Nested {
+		res["comments"] = models.CommentsWithUserToThreads(comments)
+	} else {
+		res["comments"] = models.CommentsWithUserToDTO(comments)
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Locking stops everyone except moderators from adding new comments to the rice
+func setRiceCommentsLocked(c *gin.Context, locked bool) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	if err := checkCanManageDiscussion(token, path.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	updated, err := repository.SetCommentsLocked(path.RiceID, locked)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !updated {
+		c.Error(errs.RiceNotFound)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func LockRiceComments(c *gin.Context) {
+	setRiceCommentsLocked(c, true)
+}
+
+func UnlockRiceComments(c *gin.Context) {
+	setRiceCommentsLocked(c, false)
 }
 
 func DownloadDotfiles(c *gin.Context) {
@@ -208,6 +444,11 @@ func DownloadDotfiles(c *gin.Context) {
 		return
 	}
 
+	if !canViewRice(GetTokenFromRequest(c), rice) {
+		c.Error(errs.RiceNotFound)
+		return
+	}
+
 	filePath, err := repository.IncrementDotfilesDownloads(path.RiceID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -219,6 +460,14 @@ func DownloadDotfiles(c *gin.Context) {
 		return
 	}
 
+	// anonymous downloads are grouped together, author's own downloads are skipped by notify
+	notify(rice.Rice.AuthorID.String(), notification{
+		Type:    models.DownloadNotification,
+		ActorID: GetUserIdFromRequest(c),
+		RiceID:  &path.RiceID,
+		Dedupe:  true,
+	})
+
 	fullPath := "./public" + filePath
 
 	ext := filepath.Ext(filePath)
@@ -234,6 +483,10 @@ func CreateRice(c *gin.Context) {
 		c.Error(err)
 		return
 	}
+	if err := security.VerifyRestriction(token.Subject, models.UploadRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	// validate everything first
 	form, err := c.MultipartForm()
@@ -269,6 +522,7 @@ func CreateRice(c *gin.Context) {
 	dotfilesFile := formDotfiles[0]
 
 	validPreviews := make(map[string]*multipart.FileHeader, len(previews))
+	previewHashes := make(map[string]uint64, len(previews))
 	for _, preview := range previews {
 		ext, err := utils.ValidateFileAsImage(preview)
 		if err != nil {
@@ -276,8 +530,15 @@ func CreateRice(c *gin.Context) {
 			return
 		}
 
+		hash, err := utils.ComputePreviewHash(preview)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
 		previewPath := fmt.Sprintf("/previews/%v%v", uuid.New(), ext)
 		validPreviews[previewPath] = preview
+		previewHashes[previewPath] = hash
 	}
 
 	dotfilesExt, err := utils.ValidateFileAsArchive(dotfilesFile)
@@ -286,14 +547,14 @@ func CreateRice(c *gin.Context) {
 		return
 	}
 
-	// check if title or description contains blacklisted words
-	bl := utils.Config.Blacklist.Words
-	if utils.ContainsBlacklistedWord(metadata.Title, bl) {
-		c.Error(blacklistedTitle)
+	// run title and description through the content filter
+	var check contentCheck
+	if err := check.filter(&metadata.Title, blacklistedTitle); err != nil {
+		c.Error(err)
 		return
 	}
-	if utils.ContainsBlacklistedWord(metadata.Description, bl) {
-		c.Error(blacklistedDescription)
+	if err := check.filter(&metadata.Description, blacklistedDescription); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -307,8 +568,16 @@ func CreateRice(c *gin.Context) {
 	}
 	defer tx.Rollback(context.Background())
 
+	// admins' rices don't need to be reviewed
+	state := models.Waiting
+	if metadata.Draft {
+		state = models.Draft
+	} else if token.IsAdmin {
+		state = models.Accepted
+	}
+
 	// insert the rice base (we need rice id for db relation)
-	rice, err := repository.InsertRice(tx, token.Subject, metadata.Title, slug.Make(metadata.Title), metadata.Description, token.IsAdmin)
+	rice, err := repository.InsertRice(tx, token.Subject, metadata.Title, slug.Make(metadata.Title), metadata.Description, state)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
@@ -325,7 +594,13 @@ func CreateRice(c *gin.Context) {
 	for path, file := range validPreviews {
 		c.SaveUploadedFile(file, "./public"+path)
 
-		if err := repository.InsertRicePreviewTx(tx, rice.ID, path); err != nil {
+		preview, err := repository.InsertRicePreviewTx(tx, rice.ID, path, previewHashes[path])
+		if err != nil {
+			c.Error(errs.InternalError(err))
+			return
+		}
+
+		if err := flagDuplicatePreviews(tx, preview); err != nil {
 			c.Error(errs.InternalError(err))
 			return
 		}
@@ -351,6 +626,9 @@ func CreateRice(c *gin.Context) {
 		return
 	}
 
+	riceID := rice.ID.String()
+	check.report(models.RiceTarget, repository.ReportTargetIDs{RiceID: &riceID})
+
 	// c.JSON(http.StatusCreated, dto)
 	c.Status(http.StatusCreated)
 }
@@ -384,14 +662,14 @@ func UpdateRiceMetadata(c *gin.Context) {
 		return
 	}
 
-	// check against blacklisted words
-	bl := utils.Config.Blacklist.Words
-	if metadata.Title != nil && utils.ContainsBlacklistedWord(*metadata.Title, bl) {
-		c.Error(blacklistedTitle)
+	// check against content filter
+	var check contentCheck
+	if err := check.filter(metadata.Title, blacklistedTitle); err != nil {
+		c.Error(err)
 		return
 	}
-	if metadata.Description != nil && utils.ContainsBlacklistedWord(*metadata.Description, bl) {
-		c.Error(blacklistedDescription)
+	if err := check.filter(metadata.Description, blacklistedDescription); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -401,6 +679,8 @@ func UpdateRiceMetadata(c *gin.Context) {
 		return
 	}
 
+	check.report(models.RiceTarget, repository.ReportTargetIDs{RiceID: &path.RiceID})
+
 	c.Status(http.StatusCreated)
 }
 
@@ -410,6 +690,10 @@ func UpdateDotfiles(c *gin.Context) {
 		c.Error(err)
 		return
 	}
+	if err := security.VerifyRestriction(token.Subject, models.UploadRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	var path ricesPath
 	if err := c.ShouldBindUri(&path); err != nil {
@@ -466,6 +750,10 @@ func AddScreenshot(c *gin.Context) {
 		c.Error(err)
 		return
 	}
+	if err := security.VerifyRestriction(token.Subject, models.UploadRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	var path ricesPath
 	if err := c.ShouldBindUri(&path); err != nil {
@@ -500,19 +788,49 @@ func AddScreenshot(c *gin.Context) {
 		return
 	}
 
+	hash, err := utils.ComputePreviewHash(file)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := repository.StartTx(ctx)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
 	filePath := fmt.Sprintf("/previews/%v%v", uuid.New(), ext)
 	c.SaveUploadedFile(file, "./public"+filePath)
 
-	_, err = repository.InsertRicePreview(path.RiceID, filePath)
+	preview, err := repository.InsertRicePreviewTx(tx, uuid.MustParse(path.RiceID), filePath, hash)
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
 	}
 
+	if err := flagDuplicatePreviews(tx, preview); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"preview": utils.Config.CDNUrl + filePath})
 }
 
 func UpdateRiceState(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyUserID(token.Subject); err != nil {
+		c.Error(err)
+		return
+	}
+
 	var path ricesPath
 	if err := c.ShouldBindUri(&path); err != nil {
 		c.Error(invalidRiceID)
@@ -535,28 +853,50 @@ func UpdateRiceState(c *gin.Context) {
 		c.Error(errs.InternalError(err))
 		return
 	}
-	if rice.Rice.State == models.Accepted {
-		c.Error(errs.UserError("This rice has been already accepted", http.StatusConflict))
+
+	isAuthor := rice.Rice.AuthorID.String() == token.Subject
+	if !isAuthor && !token.IsAdmin {
+		c.Error(errs.NoAccess)
 		return
 	}
 
-	switch update.NewState {
-	case "accepted":
-		err := repository.UpdateRiceState(path.RiceID, models.Accepted)
-		if err != nil {
-			c.Error(errs.InternalError(err))
-			return
-		}
-		c.Status(http.StatusOK)
-	case "rejected":
-		_, err := repository.DeleteRice(path.RiceID)
-		if err != nil {
-			zap.L().Error("Database error when trying to delete rejected rice", zap.String("riceId", path.RiceID), zap.Error(err))
-			c.Error(errs.InternalError(err))
-			return
+	if err := changeRiceState(token, rice.Rice, models.RiceState(update.NewState), update.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetRiceStateHistory(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path ricesPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidRiceID)
+		return
+	}
+
+	if err := checkCanUserModifyRice(token, path.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	history, err := repository.FetchRiceStateHistory(path.RiceID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// authors can see why the state changed but not which moderator did it
+	if !token.IsAdmin {
+		for i := range history {
+			history[i].ChangedBy = nil
+			history[i].ChangedByUsername = nil
 		}
-		c.Status(http.StatusNoContent)
 	}
+
+	c.JSON(http.StatusOK, models.RiceStateChangesToDTO(history))
 }
 
 func DeleteScreenshot(c *gin.Context) {
@@ -613,6 +953,10 @@ func DeleteScreenshot(c *gin.Context) {
 
 func AddRiceStar(c *gin.Context) {
 	token := c.MustGet("token").(*security.AccessToken)
+	if err := security.VerifyRestriction(token.Subject, models.StarRestriction); err != nil {
+		c.Error(err)
+		return
+	}
 
 	var path ricesPath
 	if err := c.ShouldBindUri(&path); err != nil {
@@ -620,6 +964,11 @@ func AddRiceStar(c *gin.Context) {
 		return
 	}
 
+	if err := checkCanViewRice(token, path.RiceID); err != nil {
+		c.Error(err)
+		return
+	}
+
 	if err := repository.InsertRiceStar(path.RiceID, token.Subject); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -637,6 +986,8 @@ func AddRiceStar(c *gin.Context) {
 		return
 	}
 
+	notifyRiceAuthor(path.RiceID, notification{Type: models.StarNotification, ActorID: &token.Subject, Dedupe: true})
+	publishStarCount(path.RiceID)
 	c.Status(http.StatusCreated)
 }
 
@@ -654,6 +1005,8 @@ func DeleteRiceStar(c *gin.Context) {
 		return
 	}
 
+	publishStarCount(path.RiceID)
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -26,7 +26,15 @@ type usersPath struct {
 	UserID string `uri:"id" binding:"required,uuid"`
 }
 
+type userBansPath struct {
+	UserID string `uri:"id" binding:"required,uuid"`
+	BanID  string `uri:"banId" binding:"required,uuid"`
+}
+
 var invalidUserID = errs.UserError("Invalid user ID provided. It must be a valid UUID.", http.StatusBadRequest)
+var invalidBanPath = errs.UserError("Invalid user or ban ID provided. They must be valid UUIDs.", http.StatusBadRequest)
+var banNotFound = errs.UserError("Ban with provided ID not found", http.StatusNotFound)
+var banNotActive = errs.UserError("Ban is not active anymore", http.StatusConflict)
 var queryRequired = errs.UserError("At least one query parameter is required", http.StatusBadRequest)
 
 func findUser(userID string) (*models.User, error) {
@@ -80,6 +88,10 @@ func GetTokenFromRequest(c *gin.Context) *security.AccessToken {
 	tokenStr = strings.TrimSpace(tokenStr)
 
 	token, err := security.ValidateToken(tokenStr)
+	if err == nil {
+		// tokens revoked e.g. by password reset must not work on optional auth routes either
+		err = security.VerifySession(token.Subject, token.IssuedAt)
+	}
 	if err == nil {
 		return token
 	}
@@ -249,8 +261,8 @@ func GetUserRiceBySlug(c *gin.Context) {
 		return
 	}
 
-	// check if rice is pending approval and if so, is the user permitted to see it
-	if rice.Rice.State == models.Waiting && (token == nil || !token.IsAdmin) {
+	// check if rice is not public and if so, is the user permitted to see it
+	if !canViewRice(token, rice) {
 		c.Error(errs.RiceNotFound)
 		return
 	}
@@ -304,7 +316,7 @@ func UpdateDisplayName(c *gin.Context) {
 	}
 
 	// check if display name is blacklisted
-	if utils.IsDisplayNameBlacklisted(body.DisplayName) {
+	if security.IsDisplayNameBlacklisted(body.DisplayName) {
 		c.Error(errs.BlacklistedDisplayName)
 		return
 	}
@@ -448,8 +460,13 @@ func BanUser(c *gin.Context) {
 		return
 	}
 
-	// 3. check if user exists AND is not already banned
-	state, err := repository.IsUserBanned(path.UserID)
+	// 3. check if user exists AND is not already banned (or restricted in the same scope)
+	scope := models.FullBan
+	if ban.Scope != "" {
+		scope = models.BanScope(ban.Scope)
+	}
+
+	state, err := repository.IsUserBanned(path.UserID, scope)
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
@@ -459,12 +476,16 @@ func BanUser(c *gin.Context) {
 		return
 	}
 	if state.UserBanned {
-		c.Error(errs.UserError("User is already banned", http.StatusConflict))
+		if scope == models.FullBan {
+			c.Error(errs.UserError("User is already banned", http.StatusConflict))
+		} else {
+			c.Error(errs.UserError(fmt.Sprintf("User already has an active '%v' restriction", scope), http.StatusConflict))
+		}
 		return
 	}
 
 	// 4. insert ban into the database
-	userBan, err := repository.InsertBan(path.UserID, token.Subject, ban.Reason, expiresAt)
+	userBan, err := repository.InsertBan(path.UserID, token.Subject, scope, ban.Reason, expiresAt)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.CheckViolation {
@@ -476,22 +497,34 @@ func BanUser(c *gin.Context) {
 		return
 	}
 
-	// 5. remove user permissions (if has any)
-	if err := repository.RemoveAdminFromUser(path.UserID); err != nil {
-		c.Error(errs.InternalError(err))
-		zap.L().Error(
-			"Failed to remove admin role after user ban",
-			zap.String("userID", path.UserID),
-			zap.Error(err),
-		)
-		return
+	// 5. remove user permissions (if has any), restrictions don't affect admin role
+	if scope == models.FullBan {
+		if err := repository.RemoveAdminFromUser(path.UserID); err != nil {
+			c.Error(errs.InternalError(err))
+			zap.L().Error(
+				"Failed to remove admin role after user ban",
+				zap.String("userID", path.UserID),
+				zap.Error(err),
+			)
+			return
+		}
 	}
 
-	// 6. return 201 with ban id in json
+	// 6. let the user know why they were banned, shadow bans have to stay unnoticed
+	if scope != models.ShadowBan {
+		notify(path.UserID, notification{
+			Type: models.BanNotification,
+			Data: map[string]any{"banId": userBan.ID, "scope": scope, "reason": ban.Reason, "expiresAt": expiresAt},
+		})
+	}
+
+	// 7. return 201 with ban id in json
 	c.JSON(http.StatusCreated, userBan.ToDTO())
 }
 
 func UnbanUser(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
 	var path usersPath
 	if err := c.ShouldBindUri(&path); err != nil {
 		c.Error(invalidUserID)
@@ -499,7 +532,7 @@ func UnbanUser(c *gin.Context) {
 	}
 
 	// 1. check if user is banned
-	state, err := repository.IsUserBanned(path.UserID)
+	state, err := repository.IsUserBanned(path.UserID, models.FullBan)
 	if err != nil {
 		c.Error(errs.InternalError(err))
 		return
@@ -514,7 +547,7 @@ func UnbanUser(c *gin.Context) {
 	}
 
 	// 2. revoke ban in the database
-	if err := repository.RevokeBan(path.UserID); err != nil {
+	if err := repository.RevokeBan(path.UserID, token.Subject); err != nil {
 		c.Error(errs.InternalError(err))
 		return
 	}
@@ -523,6 +556,145 @@ func UnbanUser(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// Lists every ban of the user together with changes made to them
+func GetUserBans(c *gin.Context) {
+	var path usersPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidUserID)
+		return
+	}
+
+	state, err := repository.IsUserBanned(path.UserID, models.FullBan)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !state.UserExists {
+		c.Error(errs.UserNotFound)
+		return
+	}
+
+	bans, err := repository.FetchUserBans(path.UserID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	changes, err := repository.FetchUserBanChanges(path.UserID)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// attach changes to their bans
+	history := make([]models.UserBanWithChanges, len(bans))
+	indexes := make(map[uuid.UUID]int, len(bans))
+	for i, ban := range bans {
+		history[i] = models.UserBanWithChanges{Ban: ban, Changes: []models.UserBanChange{}}
+		indexes[ban.ID] = i
+	}
+	for _, change := range changes {
+		if i, ok := indexes[change.BanID]; ok {
+			history[i].Changes = append(history[i].Changes, change)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.UserBansWithChangesToDTO(history))
+}
+
+func UpdateUserBan(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path userBansPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidBanPath)
+		return
+	}
+
+	var update models.UpdateUserBanDTO
+	if err := utils.ValidateJSON(c, &update); err != nil {
+		c.Error(err)
+		return
+	}
+	if update.Reason == nil && update.Duration == nil && !update.Permanent {
+		c.Error(errs.UserError("Nothing to update", http.StatusBadRequest))
+		return
+	}
+
+	ban, err := repository.FindUserBan(path.UserID, path.BanID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(banNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	// new duration is counted from the moment the user got banned
+	changeExpiration := update.Permanent || update.Duration != nil
+	var expiresAt *time.Time
+	if update.Duration != nil {
+		parsed, err := time.ParseDuration(*update.Duration)
+		if err != nil || parsed <= 0 {
+			c.Error(errs.UserError("Duration must be a valid positive value", http.StatusBadRequest))
+			return
+		}
+
+		temp := ban.BannedAt.Add(parsed)
+		if temp.Before(time.Now()) {
+			c.Error(errs.UserError("New duration would end the ban immediately. Revoke it instead.", http.StatusBadRequest))
+			return
+		}
+		expiresAt = &temp
+	}
+
+	ban, err = repository.UpdateBan(path.BanID, token.Subject, update.Reason, changeExpiration, expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(banNotActive)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, ban.ToDTO())
+}
+
+func RevokeUserBan(c *gin.Context) {
+	token := c.MustGet("token").(*security.AccessToken)
+
+	var path userBansPath
+	if err := c.ShouldBindUri(&path); err != nil {
+		c.Error(invalidBanPath)
+		return
+	}
+
+	if _, err := repository.FindUserBan(path.UserID, path.BanID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.Error(banNotFound)
+			return
+		}
+
+		c.Error(errs.InternalError(err))
+		return
+	}
+
+	revoked, err := repository.RevokeBanById(path.BanID, token.Subject)
+	if err != nil {
+		c.Error(errs.InternalError(err))
+		return
+	}
+	if !revoked {
+		c.Error(banNotActive)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func DeleteAvatar(c *gin.Context) {
 	var path usersPath
 	if err := c.ShouldBindUri(&path); err != nil {
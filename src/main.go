@@ -36,18 +36,31 @@ func main() {
 		logger.Warn("Maintenance mode toggled! Is it intentional?")
 	}
 
+	utils.InitMailer()
+	security.ValidateLoginConfig()
+
 	utils.InitCache(utils.Config.RedisUrl)
 	defer utils.CloseCache()
 
 	repository.Init(utils.Config.DatabaseUrl)
 	defer repository.Close()
 
+	if err := security.ImportBlacklistedWords(); err != nil {
+		logger.Fatal("Failed to import blacklisted words", zap.Error(err))
+	}
+	if err := security.ReloadContentFilter(); err != nil {
+		logger.Fatal("Failed to load content filter rules", zap.Error(err))
+	}
+	go security.WatchContentFilter()
+	go utils.WatchEvents()
+	go handlers.ProcessEmailQueue()
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 
 	corsConfig := cors.Config{
 		AllowOrigins:     []string{utils.Config.CorsOrigin},
-		AllowMethods:     []string{"GET", "POST", "DELETE", "PATCH"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
 		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
 		ExposeHeaders:    []string{"Content-Length", "Set-Cookie"},
 		AllowCredentials: true,
@@ -114,12 +127,20 @@ func setupRoutes(r *gin.Engine) {
 		c.JSON(http.StatusOK, gin.H{"message": "I'm working and responding!"})
 	})
 
+	// banned networks can still read, accounts and content can't be created from them
+	ipBan := security.IPBanMiddleware(false)
+	strictIPBan := security.IPBanMiddleware(true)
+
 	auth := r.Group("/auth")
 	{
-		auth.POST("/register", security.MaintenanceMiddleware(), handlers.Register)
-		auth.POST("/login", handlers.Login)
+		auth.POST("/register", security.MaintenanceMiddleware(), strictIPBan, handlers.Register)
+		auth.POST("/login", strictIPBan, handlers.Login)
 		auth.POST("/refresh", security.PathRateLimitMiddleware(100, 1*time.Minute), handlers.RefreshToken)
 		auth.POST("/logout", handlers.LogOut)
+		auth.POST("/appeal", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(5, 24*time.Hour), handlers.AppealBan)
+		auth.POST("/password-reset", security.PathRateLimitMiddleware(5, time.Hour), handlers.RequestPasswordReset)
+		auth.POST("/password-reset/confirm", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, time.Hour), handlers.ResetPassword)
+		auth.POST("/verify-email", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, time.Hour), handlers.VerifyEmail)
 	}
 
 	users := r.Group("/users")
@@ -131,15 +152,23 @@ func setupRoutes(r *gin.Engine) {
 
 		authedOnly := users.Use(security.AuthMiddleware)
 		authedOnly.GET("/:id", defaultRL, handlers.GetUserById)
-		authedOnly.DELETE("/:id", security.MaintenanceMiddleware(), defaultRL, handlers.DeleteUser) // should this be affected by maintenance mode?
-		authedOnly.PATCH("/:id/displayName", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UpdateDisplayName)
-		authedOnly.PATCH("/:id/password", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UpdatePassword)
-		authedOnly.POST("/:id/avatar", security.MaintenanceMiddleware(), security.FileSizeLimitMiddleware(utils.Config.Limits.UserAvatarSizeLimit), security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UploadAvatar)
-		authedOnly.DELETE("/:id/avatar", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.DeleteAvatar)
+		authedOnly.DELETE("/:id", security.MaintenanceMiddleware(), ipBan, defaultRL, handlers.DeleteUser) // should this be affected by maintenance mode?
+		authedOnly.PATCH("/:id/displayName", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UpdateDisplayName)
+		authedOnly.PATCH("/:id/password", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UpdatePassword)
+		authedOnly.POST("/:id/avatar", security.MaintenanceMiddleware(), ipBan, security.FileSizeLimitMiddleware(utils.Config.Limits.UserAvatarSizeLimit), security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UploadAvatar)
+		authedOnly.DELETE("/:id/avatar", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.DeleteAvatar)
+		authedOnly.GET("/:id/email", defaultRL, handlers.GetUserEmail)
+		authedOnly.PATCH("/:id/email", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.UpdateUserEmail)
+		authedOnly.DELETE("/:id/email", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, 24*time.Hour), handlers.DeleteUserEmail)
+		authedOnly.POST("/:id/email/verification", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(5, time.Hour), handlers.ResendEmailVerification)
 
 		adminOnly := users.Use(security.AdminMiddleware)
 		adminOnly.POST("/:id/ban", handlers.BanUser)
 		adminOnly.DELETE("/:id/ban", handlers.UnbanUser)
+		adminOnly.GET("/:id/bans", handlers.GetUserBans)
+		adminOnly.GET("/:id/network", handlers.GetUserNetwork)
+		adminOnly.PATCH("/:id/bans/:banId", handlers.UpdateUserBan)
+		adminOnly.DELETE("/:id/bans/:banId", handlers.RevokeUserBan)
 	}
 
 	profiles := r.Group("/profiles")
@@ -166,40 +195,88 @@ func setupRoutes(r *gin.Engine) {
 
 		auth := rices.Use(security.AuthMiddleware)
 		// This is actually unreadable, I feel like Im gonna have a seizure trying to comprehend this line
-		auth.POST("", security.MaintenanceMiddleware(), security.FileSizeLimitMiddleware(utils.Config.Limits.DotfilesSizeLimit+int64(utils.Config.Limits.MaxPreviewsPerRice)*utils.Config.Limits.PreviewSizeLimit), security.PathRateLimitMiddleware(15, 24*time.Hour), handlers.CreateRice)
-		auth.PATCH("/:id", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(5, time.Hour), handlers.UpdateRiceMetadata)
-		auth.POST("/:id/dotfiles", security.MaintenanceMiddleware(), security.FileSizeLimitMiddleware(utils.Config.Limits.DotfilesSizeLimit), security.PathRateLimitMiddleware(5, time.Hour), handlers.UpdateDotfiles)
-		auth.POST("/:id/screenshots", security.MaintenanceMiddleware(), security.FileSizeLimitMiddleware(utils.Config.Limits.PreviewSizeLimit), security.PathRateLimitMiddleware(25, time.Hour), handlers.AddScreenshot)
-		auth.PATCH("/:id/state", security.MaintenanceMiddleware(), security.AdminMiddleware, handlers.UpdateRiceState)
-		auth.POST("/:id/star", security.MaintenanceMiddleware(), handlers.AddRiceStar)
-		auth.DELETE("/:id/star", security.MaintenanceMiddleware(), handlers.DeleteRiceStar)
-		auth.DELETE("/:id/screenshots/:previewId", security.MaintenanceMiddleware(), handlers.DeleteScreenshot)
-		auth.DELETE("/:id", security.MaintenanceMiddleware(), handlers.DeleteRice)
+		auth.POST("", security.MaintenanceMiddleware(), ipBan, security.FileSizeLimitMiddleware(utils.Config.Limits.DotfilesSizeLimit+int64(utils.Config.Limits.MaxPreviewsPerRice)*utils.Config.Limits.PreviewSizeLimit), security.PathRateLimitMiddleware(15, 24*time.Hour), handlers.CreateRice)
+		auth.PATCH("/:id", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(5, time.Hour), handlers.UpdateRiceMetadata)
+		auth.POST("/:id/dotfiles", security.MaintenanceMiddleware(), ipBan, security.FileSizeLimitMiddleware(utils.Config.Limits.DotfilesSizeLimit), security.PathRateLimitMiddleware(5, time.Hour), handlers.UpdateDotfiles)
+		auth.POST("/:id/screenshots", security.MaintenanceMiddleware(), ipBan, security.FileSizeLimitMiddleware(utils.Config.Limits.PreviewSizeLimit), security.PathRateLimitMiddleware(25, time.Hour), handlers.AddScreenshot)
+		auth.PATCH("/:id/state", security.MaintenanceMiddleware(), ipBan, handlers.UpdateRiceState)
+		auth.GET("/:id/state/history", handlers.GetRiceStateHistory)
+		auth.POST("/:id/comments/lock", security.MaintenanceMiddleware(), ipBan, handlers.LockRiceComments)
+		auth.DELETE("/:id/comments/lock", security.MaintenanceMiddleware(), ipBan, handlers.UnlockRiceComments)
+		auth.POST("/:id/star", security.MaintenanceMiddleware(), ipBan, handlers.AddRiceStar)
+		auth.DELETE("/:id/star", security.MaintenanceMiddleware(), ipBan, handlers.DeleteRiceStar)
+		auth.DELETE("/:id/screenshots/:previewId", security.MaintenanceMiddleware(), ipBan, handlers.DeleteScreenshot)
+		auth.DELETE("/:id", security.MaintenanceMiddleware(), ipBan, handlers.DeleteRice)
 	}
 
 	comments := r.Group("/comments").Use(security.AuthMiddleware)
 	{
 		comments.GET("", security.AdminMiddleware, handlers.GetRecentComments)
 
-		comments.POST("", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, time.Hour), handlers.AddComment)
+		comments.POST("", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, time.Hour), handlers.AddComment)
 		comments.GET("/:id", security.PathRateLimitMiddleware(10, time.Minute), handlers.GetCommentById)
-		comments.PATCH("/:id", security.MaintenanceMiddleware(), security.PathRateLimitMiddleware(10, time.Hour), handlers.UpdateComment)
-		comments.DELETE("/:id", security.MaintenanceMiddleware(), handlers.DeleteComment)
+		comments.PATCH("/:id", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(10, time.Hour), handlers.UpdateComment)
+		comments.DELETE("/:id", security.MaintenanceMiddleware(), ipBan, handlers.DeleteComment)
+		comments.POST("/:id/pin", security.MaintenanceMiddleware(), ipBan, handlers.PinComment)
+		comments.DELETE("/:id/pin", security.MaintenanceMiddleware(), ipBan, handlers.UnpinComment)
+		comments.POST("/:id/hide", security.MaintenanceMiddleware(), ipBan, handlers.HideRiceComment)
+		comments.DELETE("/:id/hide", security.MaintenanceMiddleware(), ipBan, handlers.UnhideRiceComment)
+		comments.GET("/:id/history", security.AdminMiddleware, handlers.GetCommentHistory)
+		comments.POST("/:id/restore", security.AdminMiddleware, handlers.RestoreComment)
+		// both routes share the same rate limit so reactions can't be toggled endlessly
+		comments.PUT("/:id/reaction", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(20, time.Minute), handlers.ReactToComment)
+		comments.DELETE("/:id/reaction", security.MaintenanceMiddleware(), ipBan, security.PathRateLimitMiddleware(20, time.Minute), handlers.DeleteCommentReaction)
+	}
+
+	// long-lived Server-Sent Events stream, see handlers.StreamEvents
+	r.GET("/events", security.StreamAuthMiddleware, security.PathRateLimitMiddleware(20, time.Minute), handlers.StreamEvents)
+
+	notifications := r.Group("/notifications").Use(security.AuthMiddleware)
+	{
+		notifications.GET("", handlers.GetNotifications)
+		notifications.POST("/read-all", handlers.MarkAllNotificationsRead)
+		notifications.POST("/:id/read", handlers.MarkNotificationRead)
+		notifications.GET("/preferences", handlers.GetNotificationPreferences)
+		notifications.PATCH("/preferences", security.MaintenanceMiddleware(), handlers.UpdateNotificationPreferences)
 	}
 
 	reports := r.Group("/reports").Use(security.AuthMiddleware)
 	{
-		reports.POST("", security.PathRateLimitMiddleware(50, 24*time.Hour), handlers.CreateReport)
+		reports.POST("", ipBan, security.PathRateLimitMiddleware(50, 24*time.Hour), handlers.CreateReport)
 
 		adminOnly := reports.Use(security.AdminMiddleware)
 		adminOnly.GET("", handlers.FetchReports)
+		adminOnly.GET("/targets", handlers.FetchReportedTargets)
 		adminOnly.GET("/:reportId", handlers.GetReportById)
-		adminOnly.POST("/:reportId/close", handlers.CloseReport)
+		adminOnly.PATCH("/:reportId", handlers.UpdateReport)
 	}
 
 	admin := r.Group("/admin").Use(security.AuthMiddleware, security.AdminMiddleware)
 	{
 		admin.GET("/stats", handlers.ServiceStatistics)
+
+		admin.GET("/filter-rules", handlers.FetchFilterRules)
+		admin.POST("/filter-rules", handlers.CreateFilterRule)
+		admin.PATCH("/filter-rules/:id", handlers.UpdateFilterRule)
+		admin.DELETE("/filter-rules/:id", handlers.DeleteFilterRule)
+
+		admin.GET("/ip-bans", handlers.FetchIPBans)
+		admin.POST("/ip-bans", handlers.CreateIPBan)
+		admin.DELETE("/ip-bans/:id", handlers.DeleteIPBan)
+		admin.GET("/login-lockouts", handlers.FetchLoginLockouts)
+
+		admin.GET("/appeals", handlers.FetchBanAppeals)
+		admin.PATCH("/appeals/:banId", handlers.ReviewBanAppeal)
+
+		admin.POST("/emails/test", security.PathRateLimitMiddleware(10, time.Hour), handlers.SendTestEmail)
+
+		admin.GET("/queue", handlers.FetchModerationQueue)
+		admin.POST("/queue/:id/claim", handlers.ClaimRice)
+		admin.DELETE("/queue/:id/claim", handlers.ReleaseRiceClaim)
+		admin.GET("/queue/:id/notes", handlers.GetReviewNotes)
+		admin.POST("/queue/:id/notes", handlers.AddReviewNote)
+		admin.POST("/queue/:id/approve", security.MaintenanceMiddleware(), handlers.ApproveRice)
+		admin.POST("/queue/:id/reject", security.MaintenanceMiddleware(), handlers.RejectRice)
 	}
 
 	webVars := r.Group("/vars")
@@ -33,19 +33,68 @@ type Tag struct {
 type RiceState string
 
 const (
+	Draft    RiceState = "draft"
 	Waiting  RiceState = "waiting"
 	Accepted RiceState = "accepted"
+	Rejected RiceState = "rejected"
+	Hidden   RiceState = "hidden"
+	Archived RiceState = "archived"
 )
 
+type stateTransition struct {
+	To        RiceState
+	AdminOnly bool
+}
+
+// All allowed rice state transitions.
+// Transitions that are not admin only can be done by the rice author (and admins).
+var riceTransitions = map[RiceState][]stateTransition{
+	Draft:    {{Waiting, false}, {Archived, false}},
+	Waiting:  {{Accepted, true}, {Rejected, true}, {Draft, false}, {Archived, false}},
+	Accepted: {{Hidden, true}, {Archived, false}},
+	Rejected: {{Waiting, false}, {Draft, false}, {Archived, false}},
+	Hidden:   {{Accepted, true}, {Archived, false}},
+	Archived: {{Draft, false}, {Waiting, false}},
+}
+
+// Checks whether rice in this state can be moved to the next one by the user
+func (s RiceState) CanTransitionTo(next RiceState, isAdmin bool) bool {
+	for _, t := range riceTransitions[s] {
+		if t.To == next {
+			return isAdmin || !t.AdminOnly
+		}
+	}
+	return false
+}
+
+// Whether the rice in this state is visible to everyone and not only to the author and admins
+func (s RiceState) IsPublic() bool {
+	return s == Accepted
+}
+
 type Rice struct {
-	ID          uuid.UUID
-	AuthorID    uuid.UUID `json:"author_id"`
-	Title       string
-	Slug        string
-	Description string
-	State       RiceState
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID              uuid.UUID
+	AuthorID        uuid.UUID `json:"author_id"`
+	Title           string
+	Slug            string
+	Description     string
+	State           RiceState
+	StateReason     *string    `json:"state_reason"`
+	CommentsLocked  bool       `json:"comments_locked"`
+	PinnedCommentID *uuid.UUID `json:"pinned_comment_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type RiceStateChange struct {
+	ID                uuid.UUID
+	RiceID            uuid.UUID
+	ChangedBy         *uuid.UUID
+	ChangedByUsername *string
+	OldState          RiceState
+	NewState          RiceState
+	Reason            *string
+	CreatedAt         time.Time
 }
 
 type RiceDotfiles struct {
@@ -61,32 +110,100 @@ type RicePreview struct {
 	ID        uuid.UUID
 	RiceID    uuid.UUID `json:"rice_id"`
 	FilePath  string    `json:"file_path"`
+	PHash     *int64    `json:"phash"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Preview that looks (almost) the same as a preview of another author's rice
+type DuplicatePreview struct {
+	PreviewID              uuid.UUID `json:"preview_id"`
+	PreviewPath            string    `json:"preview_path"`
+	OriginalPreviewPath    string    `json:"original_preview_path"`
+	OriginalRiceID         uuid.UUID `json:"original_rice_id"`
+	OriginalRiceTitle      string    `json:"original_rice_title"`
+	OriginalRiceSlug       string    `json:"original_rice_slug"`
+	OriginalAuthorUsername string    `json:"original_author_username"`
+	Distance               int       `json:"distance"`
+}
+
 type RiceComment struct {
-	ID        uuid.UUID
-	RiceID    uuid.UUID
-	AuthorID  uuid.UUID
-	Content   string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                 uuid.UUID
+	RiceID             uuid.UUID
+	AuthorID           uuid.UUID
+	ParentID           *uuid.UUID
+	Depth              int
+	Content            string
+	IsHidden           bool
+	HiddenByRiceAuthor bool
+	EditedAt           *time.Time
+	DeletedAt          *time.Time
+	DeletedBy          *uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
 }
 
 type RiceCommentWithSlug struct {
 	ID                 uuid.UUID
 	RiceID             uuid.UUID
 	AuthorID           uuid.UUID
+	ParentID           *uuid.UUID
+	Depth              int
 	Content            string
+	IsHidden           bool
+	HiddenByRiceAuthor bool
+	EditedAt           *time.Time
+	DeletedAt          *time.Time
+	DeletedBy          *uuid.UUID
 	RiceSlug           string
+	RiceAuthorID       uuid.UUID
 	RiceAuthorUsername string
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
 }
 
+type CommentRevision struct {
+	ID             uuid.UUID
+	CommentID      uuid.UUID
+	Content        string
+	EditedBy       *uuid.UUID
+	EditorUsername *string
+	CreatedAt      time.Time
+}
+
+type CommentMention struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string
+}
+
+type CommentReaction string
+
+const (
+	LikeReaction  CommentReaction = "like"
+	LoveReaction  CommentReaction = "love"
+	LaughReaction CommentReaction = "laugh"
+	FireReaction  CommentReaction = "fire"
+	SadReaction   CommentReaction = "sad"
+)
+
 type CommentWithUser struct {
-	CommentID   uuid.UUID
-	Content     string
+	CommentID  uuid.UUID
+	ParentID   *uuid.UUID
+	Content    string
+	IsHidden   bool
+	IsDeleted  bool
+	EditedAt   *time.Time
+	ReplyCount int
+	// reply whose parent was removed together with its author's account
+	ParentRemoved bool
+	// visible only to the comment author and the rice author
+	HiddenByRiceAuthor bool
+	IsPinned           bool
+	// number of users that left each reaction
+	Reactions     map[CommentReaction]int
+	ReactionCount int
+	// reaction left by the user fetching the comments
+	OwnReaction *CommentReaction
+	Mentions    []CommentMention
 	DisplayName string
 	Username    string
 	AvatarPath  *string
@@ -102,6 +219,8 @@ type RiceWithRelations struct {
 	Previews  []RicePreview
 	StarCount uint
 	IsStarred bool
+	// content of shadow banned authors is visible only to them
+	AuthorShadowBanned bool
 }
 
 type PartialRice struct {
@@ -120,27 +239,142 @@ type PartialRice struct {
 	Score         float32
 }
 
+type WaitingRice struct {
+	PartialRice
+	Duplicates []DuplicatePreview
+}
+
+// Waiting rice as seen in the moderation queue
+type QueuedRice struct {
+	WaitingRice
+	SubmittedAt       time.Time
+	ClaimedBy         *uuid.UUID
+	ClaimedByUsername *string
+	ClaimExpiresAt    *time.Time
+	NoteCount         int
+}
+
+type RiceClaim struct {
+	RiceID      uuid.UUID
+	ModeratorID uuid.UUID
+	ClaimedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+type ReviewNote struct {
+	ID             uuid.UUID
+	RiceID         uuid.UUID
+	AuthorID       *uuid.UUID
+	AuthorUsername *string
+	Content        string
+	CreatedAt      time.Time
+}
+
+type ReportCategory string
+
+const (
+	Spam           ReportCategory = "spam"
+	StolenContent  ReportCategory = "stolen_content"
+	NSFW           ReportCategory = "nsfw"
+	Malware        ReportCategory = "malware"
+	Harassment     ReportCategory = "harassment"
+	OtherViolation ReportCategory = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportInReview  ReportStatus = "in_review"
+	ReportResolved  ReportStatus = "resolved"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Whether moderator already made a final decision on the report
+func (s ReportStatus) IsClosed() bool {
+	return s == ReportResolved || s == ReportDismissed
+}
+
+type ReportAction string
+
+const (
+	NoAction       ReportAction = "none"
+	ContentRemoved ReportAction = "content_removed"
+	UserBanned     ReportAction = "user_banned"
+)
+
+type ReportTarget string
+
+const (
+	RiceTarget    ReportTarget = "rice"
+	CommentTarget ReportTarget = "comment"
+	UserTarget    ReportTarget = "user"
+	PreviewTarget ReportTarget = "preview"
+)
+
+// reporter is nil when the report was created automatically by the content filter
 type ReportWithUser struct {
-	ID          uuid.UUID
-	ReporterID  uuid.UUID
-	DisplayName string
-	Username    string
-	Reason      string
-	RiceID      *uuid.UUID
-	CommentID   *uuid.UUID
-	IsClosed    bool
-	CreatedAt   time.Time
+	ID                uuid.UUID
+	ReporterID        *uuid.UUID
+	DisplayName       *string
+	Username          *string
+	Reason            string
+	Category          ReportCategory
+	Status            ReportStatus
+	TargetType        ReportTarget
+	RiceID            *uuid.UUID
+	CommentID         *uuid.UUID
+	UserID            *uuid.UUID
+	PreviewID         *uuid.UUID
+	ResolutionNote    *string
+	HandledBy         *uuid.UUID
+	HandledByUsername *string
+	ActionTaken       *ReportAction
+	ResolvedAt        *time.Time
+	CreatedAt         time.Time
+}
+
+// Reported resource with all of its reports aggregated
+type ReportedTarget struct {
+	TargetType        ReportTarget
+	TargetID          uuid.UUID
+	ReportCount       int
+	ReporterCount     int
+	Categories        []string
+	FirstReportedAt   time.Time
+	LastReportedAt    time.Time
+	RiceTitle         *string
+	RiceSlug          *string
+	RiceThumbnail     *string
+	CommentContent    *string
+	CommentRiceID     *uuid.UUID
+	AuthorUsername    *string
+	AuthorDisplayName *string
+	AuthorAvatarPath  *string
 }
 
 type ServiceStatistics struct {
-	UserCount       int
-	User24hCount    int
-	RiceCount       int
-	Rice24hCount    int
-	CommentCount    int
-	Comment24hCount int
-	ReportCount     int
-	OpenReportCount int
+	UserCount           int
+	User24hCount        int
+	RiceCount           int
+	Rice24hCount        int
+	CommentCount        int
+	Comment24hCount     int
+	ReportCount         int
+	OpenReportCount     int
+	WaitingRiceCount    int
+	MedianReviewSeconds float64
+	Moderators          []ModeratorStatistics `db:"-"`
+}
+
+type ModeratorStatistics struct {
+	ModeratorID         uuid.UUID
+	Username            string
+	DisplayName         string
+	ApprovedCount       int
+	RejectedCount       int
+	Review7dCount       int
+	MedianReviewSeconds float64
 }
 
 type WebsiteVariable struct {
@@ -166,9 +400,237 @@ type UserBan struct {
 	ID        uuid.UUID
 	UserID    uuid.UUID `json:"user_id"`
 	AdminID   uuid.UUID `json:"admin_id"`
+	Scope     BanScope
 	Reason    string
 	IsRevoked bool       `json:"is_revoked"`
 	ExpiresAt *time.Time `json:"expires_at"`
 	BannedAt  time.Time  `json:"banned_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
+	RevokedBy *uuid.UUID `json:"revoked_by"`
+
+	// appeal is nil until banned user submits one
+	AppealMessage    *string       `json:"appeal_message"`
+	AppealStatus     *AppealStatus `json:"appeal_status"`
+	AppealedAt       *time.Time    `json:"appealed_at"`
+	AppealResponse   *string       `json:"appeal_response"`
+	AppealReviewedBy *uuid.UUID    `json:"appeal_reviewed_by"`
+	AppealReviewedAt *time.Time    `json:"appeal_reviewed_at"`
+}
+
+// Full ban blocks the whole account, other scopes only restrict one kind of action
+type BanScope string
+
+const (
+	FullBan            BanScope = "all"
+	CommentRestriction BanScope = "comment"
+	UploadRestriction  BanScope = "upload"
+	StarRestriction    BanScope = "star"
+	ReportRestriction  BanScope = "report"
+	ReactRestriction   BanScope = "react"
+	// content of shadow banned users is visible only to themselves
+	ShadowBan BanScope = "shadow"
+)
+
+type BanChangeAction string
+
+const (
+	BanCreated BanChangeAction = "created"
+	BanUpdated BanChangeAction = "updated"
+	BanRevoked BanChangeAction = "revoked"
+)
+
+type UserBanChange struct {
+	ID            uuid.UUID
+	BanID         uuid.UUID
+	AdminID       *uuid.UUID
+	AdminUsername *string
+	Action        BanChangeAction
+	OldReason     *string
+	NewReason     *string
+	OldExpiresAt  *time.Time
+	NewExpiresAt  *time.Time
+	CreatedAt     time.Time
+}
+
+type UserBanWithChanges struct {
+	Ban     UserBan
+	Changes []UserBanChange
+}
+
+type IPBan struct {
+	ID        uuid.UUID
+	Network   string
+	AdminID   *uuid.UUID
+	Reason    string
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+type UserIPs struct {
+	RegistrationIP *string
+	LastLoginIP    *string
+	LastLoginAt    *time.Time
+}
+
+// Other account that used the same address as the checked user
+type LinkedAccount struct {
+	User
+	UserIPs
+}
+
+type FilterRuleKind string
+
+const (
+	// whole word match
+	WordRule  FilterRuleKind = "word"
+	RegexRule FilterRuleKind = "regex"
+)
+
+type FilterAction string
+
+const (
+	RejectContent FilterAction = "reject"
+	// content is accepted but reported for review
+	FlagContent FilterAction = "flag"
+	// matched part of the content is replaced with block characters
+	MaskContent FilterAction = "mask"
+)
+
+type FilterRule struct {
+	ID        uuid.UUID
+	Pattern   string
+	Kind      FilterRuleKind
+	Action    FilterAction
+	Normalize bool
+	CreatedBy *uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type AppealStatus string
+
+const (
+	AppealPending  AppealStatus = "pending"
+	AppealAccepted AppealStatus = "accepted"
+	AppealDenied   AppealStatus = "denied"
+)
+
+type BanAppeal struct {
+	UserBan
+	Username    string
+	DisplayName string
+}
+
+type NotificationType string
+
+const (
+	MentionNotification      NotificationType = "mention"
+	CommentNotification      NotificationType = "comment"
+	ReplyNotification        NotificationType = "reply"
+	StarNotification         NotificationType = "star"
+	DownloadNotification     NotificationType = "download"
+	RiceAcceptedNotification NotificationType = "rice_accepted"
+	RiceRejectedNotification NotificationType = "rice_rejected"
+	BanNotification          NotificationType = "ban"
+)
+
+var NotificationTypes = []NotificationType{
+	MentionNotification,
+	CommentNotification,
+	ReplyNotification,
+	StarNotification,
+	DownloadNotification,
+	RiceAcceptedNotification,
+	RiceRejectedNotification,
+	BanNotification,
+}
+
+type Notification struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Type   NotificationType
+	// user who caused the event
+	ActorID          *uuid.UUID
+	ActorUsername    *string
+	ActorDisplayName *string
+	ActorAvatarPath  *string
+	RiceID           *uuid.UUID
+	RiceTitle        *string
+	RiceSlug         *string
+	// needed by clients to build a link to the rice
+	RiceAuthorUsername *string
+	CommentID          *uuid.UUID
+	Data               map[string]any
+	ReadAt             *time.Time
+	CreatedAt          time.Time
+}
+
+type NotificationPreference struct {
+	Type    NotificationType
+	Enabled bool
+}
+
+type UserEmail struct {
+	UserID     uuid.UUID
+	Email      string
+	VerifiedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type EmailStatus string
+
+const (
+	EmailPending EmailStatus = "pending"
+	EmailSent    EmailStatus = "sent"
+	EmailFailed  EmailStatus = "failed"
+)
+
+type QueuedEmail struct {
+	ID            uuid.UUID
+	Recipient     string
+	Template      string
+	Data          map[string]any
+	Status        EmailStatus
+	Attempts      int
+	LastError     *string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+type UserTokenPurpose string
+
+const (
+	EmailVerificationToken UserTokenPurpose = "email_verification"
+	PasswordResetToken     UserTokenPurpose = "password_reset"
+)
+
+type UserToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   UserTokenPurpose
+	TokenHash []byte
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type LoginLockoutScope string
+
+const (
+	UsernameLockout LoginLockoutScope = "username"
+	IPLockout       LoginLockoutScope = "ip"
+)
+
+type LoginLockout struct {
+	ID             uuid.UUID
+	Scope          LoginLockoutScope
+	Username       *string
+	UserID         *uuid.UUID
+	IP             string
+	FailedAttempts int
+	LockedUntil    time.Time
+	CreatedAt      time.Time
 }
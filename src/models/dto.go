@@ -10,9 +10,10 @@ import (
 // Requests
 // AUTH
 type RegisterDTO struct {
-	Username    string `json:"username" binding:"required,min=4,max=14,alphanum"`
-	DisplayName string `json:"displayName" binding:"required,min=3,max=20,displayname"`
-	Password    string `json:"password" binding:"required,min=6,max=512"`
+	Username    string  `json:"username" binding:"required,min=4,max=14,alphanum"`
+	DisplayName string  `json:"displayName" binding:"required,min=3,max=20,displayname"`
+	Password    string  `json:"password" binding:"required,min=6,max=512"`
+	Email       *string `json:"email" binding:"omitempty,max=254,email"`
 }
 
 type LoginDTO struct {
@@ -20,6 +21,19 @@ type LoginDTO struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RequestPasswordResetDTO struct {
+	Email string `json:"email" binding:"required,max=254,email"`
+}
+
+type ResetPasswordDTO struct {
+	Token       string `json:"token" binding:"required,max=64"`
+	NewPassword string `json:"newPassword" binding:"required,min=6,max=256"`
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token" binding:"required,max=64"`
+}
+
 // USERS
 type UpdateDisplayNameDTO struct {
 	DisplayName string `json:"displayName" binding:"required,min=3,max=20,displayname"`
@@ -30,6 +44,15 @@ type UpdatePasswordDTO struct {
 	NewPassword string `json:"newPassword" binding:"required,min=6,max=256"`
 }
 
+type UpdateEmailDTO struct {
+	Email    string `json:"email" binding:"required,max=254,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type TestEmailDTO struct {
+	To string `json:"to" binding:"required,max=254,email"`
+}
+
 type DeleteUserDTO struct {
 	Password string `json:"password" binding:"required"`
 }
@@ -37,11 +60,45 @@ type DeleteUserDTO struct {
 type BanUserDTO struct {
 	Reason   string  `json:"reason" binding:"required,min=6,max=1024"`
 	Duration *string `json:"duration" binding:"omitempty"`
+	Scope    string  `json:"scope" binding:"omitempty,oneof=all comment upload star report react shadow"`
 }
 
 type UpdateUserBanDTO struct {
 	Reason   *string `json:"reason" binding:"omitempty,min=6,max=1024"`
 	Duration *string `json:"duration" binding:"omitempty"`
+	// makes the ban permanent, can't be used together with duration
+	Permanent bool `json:"permanent" binding:"excluded_with=Duration"`
+}
+
+type CreateIPBanDTO struct {
+	Network  string  `json:"network" binding:"required,cidr|ip"`
+	Reason   string  `json:"reason" binding:"required,min=6,max=1024"`
+	Duration *string `json:"duration" binding:"omitempty"`
+}
+
+type CreateFilterRuleDTO struct {
+	Pattern   string `json:"pattern" binding:"required,min=2,max=256"`
+	Kind      string `json:"kind" binding:"required,oneof=word regex"`
+	Action    string `json:"action" binding:"required,oneof=reject flag mask"`
+	Normalize *bool  `json:"normalize"`
+}
+
+type UpdateFilterRuleDTO struct {
+	Pattern   *string `json:"pattern" binding:"omitempty,min=2,max=256"`
+	Kind      *string `json:"kind" binding:"omitempty,oneof=word regex"`
+	Action    *string `json:"action" binding:"omitempty,oneof=reject flag mask"`
+	Normalize *bool   `json:"normalize"`
+}
+
+type AppealBanDTO struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Message  string `json:"message" binding:"required,min=16,max=2048"`
+}
+
+type ReviewBanAppealDTO struct {
+	Status   string  `json:"status" binding:"required,oneof=accepted denied"`
+	Response *string `json:"response" binding:"omitempty,min=6,max=1024"`
 }
 
 type UserWithBanDTO struct {
@@ -73,6 +130,7 @@ type TagNameDTO struct {
 type CreateRiceDTO struct {
 	Title       string `form:"title" binding:"required,min=4,max=32,ricetitle"`
 	Description string `form:"description" binding:"required,min=4,max=10240"`
+	Draft       bool   `form:"draft"`
 }
 
 type UpdateRiceDTO struct {
@@ -81,24 +139,58 @@ type UpdateRiceDTO struct {
 }
 
 type UpdateRiceStateDTO struct {
-	NewState string `json:"newState" binding:"required,oneof=accepted rejected"`
+	NewState string  `json:"newState" binding:"required,oneof=draft waiting accepted rejected hidden archived"`
+	Reason   *string `json:"reason" binding:"omitempty,min=4,max=1024"`
+}
+
+// MODERATION
+type ReviewNoteBodyDTO struct {
+	Content string `json:"content" binding:"required,min=2,max=2048"`
+}
+
+type RejectRiceDTO struct {
+	Reason string `json:"reason" binding:"required,min=4,max=1024"`
 }
 
 // COMMENTS
 type AddCommentDTO struct {
-	RiceID  string `json:"riceId" binding:"required,uuid"`
-	Content string `json:"content" binding:"required,min=8,max=128"`
+	RiceID   string  `json:"riceId" binding:"required,uuid"`
+	ParentID *string `json:"parentId" binding:"omitempty,uuid"`
+	Content  string  `json:"content" binding:"required,min=8,max=128"`
 }
 
 type UpdateCommentDTO struct {
 	Content string `json:"content" binding:"required,min=8,max=128"`
 }
 
+type ReactToCommentDTO struct {
+	Reaction string `json:"reaction" binding:"required,oneof=like love laugh fire sad"`
+}
+
+// NOTIFICATIONS
+type NotificationPreferenceDTO struct {
+	Type    NotificationType `json:"type" binding:"required,oneof=mention comment reply star download rice_accepted rice_rejected ban"`
+	Enabled *bool            `json:"enabled" binding:"required"`
+}
+
+type UpdateNotificationPreferencesDTO struct {
+	Preferences []NotificationPreferenceDTO `json:"preferences" binding:"required,min=1,dive"`
+}
+
 // REPORTS
 type CreateReportDTO struct {
+	Category  string  `json:"category" binding:"required,oneof=spam stolen_content nsfw malware harassment other"`
 	Reason    string  `json:"reason" binding:"required,min=8,max=1024"`
 	RiceID    *string `json:"riceId" binding:"omitempty,uuid"`
 	CommentID *string `json:"commentId" binding:"omitempty,uuid"`
+	UserID    *string `json:"userId" binding:"omitempty,uuid"`
+	PreviewID *string `json:"previewId" binding:"omitempty,uuid"`
+}
+
+type UpdateReportDTO struct {
+	Status         string  `json:"status" binding:"required,oneof=open in_review resolved dismissed"`
+	ResolutionNote *string `json:"resolutionNote" binding:"omitempty,min=2,max=2048"`
+	ActionTaken    *string `json:"actionTaken" binding:"omitempty,oneof=none content_removed user_banned"`
 }
 
 // Responses
@@ -134,6 +226,26 @@ func UsersToDTO(users []User) []UserDTO {
 	return dtos
 }
 
+type UserEmailDTO struct {
+	Email      string     `json:"email"`
+	IsVerified bool       `json:"isVerified"`
+	VerifiedAt *time.Time `json:"verifiedAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (e UserEmail) ToDTO() UserEmailDTO {
+	if e.VerifiedAt != nil {
+		*e.VerifiedAt = e.VerifiedAt.UTC()
+	}
+
+	return UserEmailDTO{
+		Email:      e.Email,
+		IsVerified: e.VerifiedAt != nil,
+		VerifiedAt: e.VerifiedAt,
+		UpdatedAt:  e.UpdatedAt.UTC(),
+	}
+}
+
 type TagDTO struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
@@ -205,18 +317,23 @@ func (p RicePreview) ToDTO() RiceScreenshotDTO {
 // This is the full DTO that contains everything shown on the rice page
 // (except comments which are fetched separately)
 type RiceWithRelationsDTO struct {
-	ID          uuid.UUID           `json:"id"`
-	Title       string              `json:"title"`
-	Slug        string              `json:"slug"`
-	Description string              `json:"description"`
-	Downloads   uint                `json:"downloads"`
-	Stars       uint                `json:"stars"`
-	IsStarred   bool                `json:"isStarred"`
-	Screenshots []RiceScreenshotDTO `json:"screenshots"`
-	Dotfiles    RiceDotfilesDTO     `json:"dotfiles"`
-	Author      UserDTO             `json:"author"`
-	CreatedAt   time.Time           `json:"createdAt"`
-	UpdatedAt   time.Time           `json:"updatedAt"`
+	ID              uuid.UUID           `json:"id"`
+	Title           string              `json:"title"`
+	Slug            string              `json:"slug"`
+	Description     string              `json:"description"`
+	DescriptionHTML string              `json:"descriptionHtml"`
+	Downloads       uint                `json:"downloads"`
+	Stars           uint                `json:"stars"`
+	IsStarred       bool                `json:"isStarred"`
+	Screenshots     []RiceScreenshotDTO `json:"screenshots"`
+	Dotfiles        RiceDotfilesDTO     `json:"dotfiles"`
+	Author          UserDTO             `json:"author"`
+	State           RiceState           `json:"state"`
+	StateReason     *string             `json:"stateReason,omitempty"`
+	CommentsLocked  bool                `json:"commentsLocked"`
+	PinnedCommentID *uuid.UUID          `json:"pinnedCommentId"`
+	CreatedAt       time.Time           `json:"createdAt"`
+	UpdatedAt       time.Time           `json:"updatedAt"`
 }
 
 func (r RiceWithRelations) ToDTO() RiceWithRelationsDTO {
@@ -226,56 +343,119 @@ func (r RiceWithRelations) ToDTO() RiceWithRelationsDTO {
 	}
 
 	return RiceWithRelationsDTO{
-		ID:          r.Rice.ID,
-		Title:       r.Rice.Title,
-		Slug:        r.Rice.Slug,
-		Description: r.Rice.Description,
-		Downloads:   r.Dotfiles.DownloadCount,
-		Stars:       r.StarCount,
-		IsStarred:   r.IsStarred,
-		Screenshots: screenshots,
-		Dotfiles:    r.Dotfiles.ToDTO(),
-		Author:      r.User.ToDTO(),
-		CreatedAt:   r.Rice.CreatedAt.UTC(),
-		UpdatedAt:   r.Rice.UpdatedAt.UTC(),
+		ID:              r.Rice.ID,
+		Title:           r.Rice.Title,
+		Slug:            r.Rice.Slug,
+		Description:     r.Rice.Description,
+		DescriptionHTML: utils.RenderMarkdown(r.Rice.Description),
+		Downloads:       r.Dotfiles.DownloadCount,
+		Stars:           r.StarCount,
+		IsStarred:       r.IsStarred,
+		Screenshots:     screenshots,
+		Dotfiles:        r.Dotfiles.ToDTO(),
+		Author:          r.User.ToDTO(),
+		State:           r.Rice.State,
+		StateReason:     r.Rice.StateReason,
+		CommentsLocked:  r.Rice.CommentsLocked,
+		PinnedCommentID: r.Rice.PinnedCommentID,
+		CreatedAt:       r.Rice.CreatedAt.UTC(),
+		UpdatedAt:       r.Rice.UpdatedAt.UTC(),
+	}
+}
+
+type RiceStateChangeDTO struct {
+	ID                uuid.UUID  `json:"id"`
+	ChangedBy         *uuid.UUID `json:"changedBy,omitempty"`
+	ChangedByUsername *string    `json:"changedByUsername,omitempty"`
+	OldState          RiceState  `json:"oldState"`
+	NewState          RiceState  `json:"newState"`
+	Reason            *string    `json:"reason"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+func (sc RiceStateChange) ToDTO() RiceStateChangeDTO {
+	return RiceStateChangeDTO{
+		ID:                sc.ID,
+		ChangedBy:         sc.ChangedBy,
+		ChangedByUsername: sc.ChangedByUsername,
+		OldState:          sc.OldState,
+		NewState:          sc.NewState,
+		Reason:            sc.Reason,
+		CreatedAt:         sc.CreatedAt.UTC(),
+	}
+}
+
+func RiceStateChangesToDTO(changes []RiceStateChange) []RiceStateChangeDTO {
+	dtos := make([]RiceStateChangeDTO, len(changes))
+	for i, sc := range changes {
+		dtos[i] = sc.ToDTO()
 	}
+	return dtos
 }
 
 type RiceCommentDTO struct {
-	ID        uuid.UUID `json:"id"`
-	RiceID    uuid.UUID `json:"riceId"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          uuid.UUID  `json:"id"`
+	RiceID      uuid.UUID  `json:"riceId"`
+	ParentID    *uuid.UUID `json:"parentId"`
+	Content     string     `json:"content"`
+	ContentHTML string     `json:"contentHtml"`
+	EditedAt    *time.Time `json:"editedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
 }
 
 func (c RiceComment) ToDTO() RiceCommentDTO {
+	if c.EditedAt != nil {
+		*c.EditedAt = c.EditedAt.UTC()
+	}
+
 	return RiceCommentDTO{
-		ID:        c.ID,
-		RiceID:    c.RiceID,
-		Content:   c.Content,
-		CreatedAt: c.CreatedAt.UTC(),
-		UpdatedAt: c.UpdatedAt.UTC(),
+		ID:          c.ID,
+		RiceID:      c.RiceID,
+		ParentID:    c.ParentID,
+		Content:     c.Content,
+		ContentHTML: utils.RenderMarkdown(c.Content),
+		EditedAt:    c.EditedAt,
+		CreatedAt:   c.CreatedAt.UTC(),
+		UpdatedAt:   c.UpdatedAt.UTC(),
 	}
 }
 
 type RiceCommentWithSlugDTO struct {
-	ID                 uuid.UUID `json:"id"`
-	RiceID             uuid.UUID `json:"riceId"`
-	AuthorID           uuid.UUID `json:"authorId"`
-	Content            string    `json:"content"`
-	RiceSlug           string    `json:"riceSlug"`
-	RiceAuthorUsername string    `json:"riceAuthorUsername"`
-	CreatedAt          time.Time `json:"createdAt"`
-	UpdatedAt          time.Time `json:"updatedAt"`
+	ID                 uuid.UUID  `json:"id"`
+	RiceID             uuid.UUID  `json:"riceId"`
+	AuthorID           uuid.UUID  `json:"authorId"`
+	ParentID           *uuid.UUID `json:"parentId"`
+	ParentRemoved      bool       `json:"parentRemoved"`
+	Content            string     `json:"content"`
+	ContentHTML        string     `json:"contentHtml"`
+	IsHidden           bool       `json:"isHidden"`
+	IsDeleted          bool       `json:"isDeleted"`
+	HiddenByRiceAuthor bool       `json:"hiddenByRiceAuthor"`
+	EditedAt           *time.Time `json:"editedAt"`
+	RiceSlug           string     `json:"riceSlug"`
+	RiceAuthorUsername string     `json:"riceAuthorUsername"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
 }
 
 func (c RiceCommentWithSlug) ToDTO() RiceCommentWithSlugDTO {
+	if c.EditedAt != nil {
+		*c.EditedAt = c.EditedAt.UTC()
+	}
+
 	return RiceCommentWithSlugDTO{
 		ID:                 c.ID,
 		RiceID:             c.RiceID,
 		AuthorID:           c.AuthorID,
+		ParentID:           c.ParentID,
+		ParentRemoved:      c.ParentID == nil && c.Depth > 0,
 		Content:            c.Content,
+		ContentHTML:        utils.RenderMarkdown(c.Content),
+		IsHidden:           c.IsHidden,
+		IsDeleted:          c.DeletedAt != nil,
+		HiddenByRiceAuthor: c.HiddenByRiceAuthor,
+		EditedAt:           c.EditedAt,
 		RiceSlug:           c.RiceSlug,
 		RiceAuthorUsername: c.RiceAuthorUsername,
 		CreatedAt:          c.CreatedAt.UTC(),
@@ -284,26 +464,62 @@ func (c RiceCommentWithSlug) ToDTO() RiceCommentWithSlugDTO {
 }
 
 type CommentWithUserDTO struct {
-	CommentID   uuid.UUID `json:"commentId"`
-	Content     string    `json:"content"`
-	DisplayName string    `json:"displayName"`
-	Username    string    `json:"username"`
-	Avatar      string    `json:"avatar"`
-	IsBanned    bool      `json:"isBanned"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	CommentID uuid.UUID  `json:"commentId"`
+	ParentID  *uuid.UUID `json:"parentId"`
+	Content   string     `json:"content"`
+	// content rendered from markdown and sanitized
+	ContentHTML string `json:"contentHtml"`
+	IsHidden    bool   `json:"isHidden"`
+	IsDeleted   bool   `json:"isDeleted"`
+	// set when the comment was edited after posting
+	EditedAt           *time.Time `json:"editedAt"`
+	ReplyCount         int        `json:"replyCount"`
+	HiddenByRiceAuthor bool       `json:"hiddenByRiceAuthor"`
+	IsPinned           bool       `json:"isPinned"`
+	// reply to a comment that no longer exists, it's listed as a top level comment
+	ParentRemoved bool `json:"parentRemoved"`
+	// reactions nobody left are omitted
+	Reactions     map[CommentReaction]int `json:"reactions"`
+	ReactionCount int                     `json:"reactionCount"`
+	OwnReaction   *CommentReaction        `json:"ownReaction"`
+	Mentions      []CommentMentionDTO     `json:"mentions"`
+	DisplayName   string                  `json:"displayName"`
+	Username      string                  `json:"username"`
+	Avatar        string                  `json:"avatar"`
+	IsBanned      bool                    `json:"isBanned"`
+	CreatedAt     time.Time               `json:"createdAt"`
+	UpdatedAt     time.Time               `json:"updatedAt"`
+	// only filled when comments are returned as nested threads
+	Replies []CommentWithUserDTO `json:"replies,omitempty"`
 }
 
 func (c CommentWithUser) ToDTO() CommentWithUserDTO {
+	if c.EditedAt != nil {
+		*c.EditedAt = c.EditedAt.UTC()
+	}
+
 	return CommentWithUserDTO{
-		CommentID:   c.CommentID,
-		Content:     c.Content,
-		DisplayName: c.DisplayName,
-		Username:    c.Username,
-		Avatar:      utils.GetUserAvatar(c.AvatarPath),
-		IsBanned:    c.IsBanned,
-		CreatedAt:   c.CreatedAt.UTC(),
-		UpdatedAt:   c.UpdatedAt.UTC(),
+		CommentID:          c.CommentID,
+		ParentID:           c.ParentID,
+		ParentRemoved:      c.ParentRemoved,
+		Content:            c.Content,
+		ContentHTML:        utils.RenderMarkdown(c.Content),
+		IsHidden:           c.IsHidden,
+		IsDeleted:          c.IsDeleted,
+		EditedAt:           c.EditedAt,
+		ReplyCount:         c.ReplyCount,
+		HiddenByRiceAuthor: c.HiddenByRiceAuthor,
+		IsPinned:           c.IsPinned,
+		Reactions:          c.Reactions,
+		ReactionCount:      c.ReactionCount,
+		OwnReaction:        c.OwnReaction,
+		Mentions:           CommentMentionsToDTO(c.Mentions),
+		DisplayName:        c.DisplayName,
+		Username:           c.Username,
+		Avatar:             utils.GetUserAvatar(c.AvatarPath),
+		IsBanned:           c.IsBanned,
+		CreatedAt:          c.CreatedAt.UTC(),
+		UpdatedAt:          c.UpdatedAt.UTC(),
 	}
 }
 
@@ -315,6 +531,154 @@ func CommentsWithUserToDTO(comments []CommentWithUser) []CommentWithUserDTO {
 	return dtos
 }
 
+type CommentMentionDTO struct {
+	UserID   uuid.UUID `json:"userId"`
+	Username string    `json:"username"`
+}
+
+func CommentMentionsToDTO(mentions []CommentMention) []CommentMentionDTO {
+	dtos := make([]CommentMentionDTO, len(mentions))
+	for i, m := range mentions {
+		dtos[i] = CommentMentionDTO{UserID: m.UserID, Username: m.Username}
+	}
+	return dtos
+}
+
+type CommentRevisionDTO struct {
+	ID             uuid.UUID  `json:"id"`
+	Content        string     `json:"content"`
+	EditedBy       *uuid.UUID `json:"editedBy"`
+	EditorUsername *string    `json:"editorUsername"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func (r CommentRevision) ToDTO() CommentRevisionDTO {
+	return CommentRevisionDTO{
+		ID:             r.ID,
+		Content:        r.Content,
+		EditedBy:       r.EditedBy,
+		EditorUsername: r.EditorUsername,
+		CreatedAt:      r.CreatedAt.UTC(),
+	}
+}
+
+func CommentRevisionsToDTO(revisions []CommentRevision) []CommentRevisionDTO {
+	dtos := make([]CommentRevisionDTO, len(revisions))
+	for i, r := range revisions {
+		dtos[i] = r.ToDTO()
+	}
+	return dtos
+}
+
+// Everything moderators need to know about what happened to the comment
+type CommentHistoryDTO struct {
+	Comment   RiceCommentWithSlugDTO `json:"comment"`
+	DeletedAt *time.Time             `json:"deletedAt"`
+	DeletedBy *uuid.UUID             `json:"deletedBy"`
+	// oldest first, the last one is the current content
+	Revisions []CommentRevisionDTO `json:"revisions"`
+}
+
+type NotificationDTO struct {
+	ID                 uuid.UUID        `json:"id"`
+	Type               NotificationType `json:"type"`
+	ActorID            *uuid.UUID       `json:"actorId"`
+	ActorUsername      *string          `json:"actorUsername"`
+	ActorDisplayName   *string          `json:"actorDisplayName"`
+	ActorAvatar        *string          `json:"actorAvatar"`
+	RiceID             *uuid.UUID       `json:"riceId"`
+	RiceTitle          *string          `json:"riceTitle"`
+	RiceSlug           *string          `json:"riceSlug"`
+	RiceAuthorUsername *string          `json:"riceAuthorUsername"`
+	CommentID          *uuid.UUID       `json:"commentId"`
+	// type specific details like rejection reason
+	Data      map[string]any `json:"data"`
+	IsRead    bool           `json:"isRead"`
+	ReadAt    *time.Time     `json:"readAt"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+func (n Notification) ToDTO() NotificationDTO {
+	if n.ReadAt != nil {
+		*n.ReadAt = n.ReadAt.UTC()
+	}
+
+	var avatar *string
+	if n.ActorID != nil {
+		url := utils.GetUserAvatar(n.ActorAvatarPath)
+		avatar = &url
+	}
+
+	return NotificationDTO{
+		ID:                 n.ID,
+		Type:               n.Type,
+		ActorID:            n.ActorID,
+		ActorUsername:      n.ActorUsername,
+		ActorDisplayName:   n.ActorDisplayName,
+		ActorAvatar:        avatar,
+		RiceID:             n.RiceID,
+		RiceTitle:          n.RiceTitle,
+		RiceSlug:           n.RiceSlug,
+		RiceAuthorUsername: n.RiceAuthorUsername,
+		CommentID:          n.CommentID,
+		Data:               n.Data,
+		IsRead:             n.ReadAt != nil,
+		ReadAt:             n.ReadAt,
+		CreatedAt:          n.CreatedAt.UTC(),
+	}
+}
+
+func (p NotificationPreference) ToDTO() NotificationPreferenceDTO {
+	return NotificationPreferenceDTO{Type: p.Type, Enabled: &p.Enabled}
+}
+
+func NotificationPreferencesToDTO(prefs []NotificationPreference) []NotificationPreferenceDTO {
+	dtos := make([]NotificationPreferenceDTO, len(prefs))
+	for i, p := range prefs {
+		dtos[i] = p.ToDTO()
+	}
+	return dtos
+}
+
+func NotificationsToDTO(notifications []Notification) []NotificationDTO {
+	dtos := make([]NotificationDTO, len(notifications))
+	for i, n := range notifications {
+		dtos[i] = n.ToDTO()
+	}
+	return dtos
+}
+
+// Builds reply trees out of flat list of comments while keeping their order.
+// Replies whose parent isn't on the list (e.g. it's hidden) are treated as top level comments.
+func CommentsWithUserToThreads(comments []CommentWithUser) []CommentWithUserDTO {
+	present := make(map[uuid.UUID]bool, len(comments))
+	for _, c := range comments {
+		present[c.CommentID] = true
+	}
+
+	children := make(map[uuid.UUID][]CommentWithUser)
+	var roots []CommentWithUser
+	for _, c := range comments {
+		if c.ParentID != nil && present[*c.ParentID] {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	var build func(list []CommentWithUser) []CommentWithUserDTO
+	build = func(list []CommentWithUser) []CommentWithUserDTO {
+		dtos := make([]CommentWithUserDTO, len(list))
+		for i, c := range list {
+			dtos[i] = c.ToDTO()
+			dtos[i].Replies = build(children[c.CommentID])
+		}
+		return dtos
+	}
+
+	return build(roots)
+}
+
 // Partial Rice is used to only show most important info about the rice
 // in places like home page, account page, profile page
 type PartialRiceDTO struct {
@@ -359,29 +723,167 @@ func PartialRicesToDTO(rices []PartialRice) []PartialRiceDTO {
 	return dtos
 }
 
+type DuplicatePreviewDTO struct {
+	PreviewID              uuid.UUID `json:"previewId"`
+	PreviewUrl             string    `json:"previewUrl"`
+	OriginalPreviewUrl     string    `json:"originalPreviewUrl"`
+	OriginalRiceID         uuid.UUID `json:"originalRiceId"`
+	OriginalRiceTitle      string    `json:"originalRiceTitle"`
+	OriginalRiceSlug       string    `json:"originalRiceSlug"`
+	OriginalAuthorUsername string    `json:"originalAuthorUsername"`
+	Distance               int       `json:"distance"`
+}
+
+func (d DuplicatePreview) ToDTO() DuplicatePreviewDTO {
+	return DuplicatePreviewDTO{
+		PreviewID:              d.PreviewID,
+		PreviewUrl:             utils.Config.CDNUrl + d.PreviewPath,
+		OriginalPreviewUrl:     utils.Config.CDNUrl + d.OriginalPreviewPath,
+		OriginalRiceID:         d.OriginalRiceID,
+		OriginalRiceTitle:      d.OriginalRiceTitle,
+		OriginalRiceSlug:       d.OriginalRiceSlug,
+		OriginalAuthorUsername: d.OriginalAuthorUsername,
+		Distance:               d.Distance,
+	}
+}
+
+// Rice waiting for approval together with all possible duplicates of its previews
+type WaitingRiceDTO struct {
+	PartialRiceDTO
+	Duplicates []DuplicatePreviewDTO `json:"duplicates"`
+}
+
+func (r WaitingRice) ToDTO() WaitingRiceDTO {
+	duplicates := make([]DuplicatePreviewDTO, len(r.Duplicates))
+	for i, d := range r.Duplicates {
+		duplicates[i] = d.ToDTO()
+	}
+
+	return WaitingRiceDTO{
+		PartialRiceDTO: r.PartialRice.ToDTO(),
+		Duplicates:     duplicates,
+	}
+}
+
+type QueuedRiceDTO struct {
+	WaitingRiceDTO
+	SubmittedAt       time.Time  `json:"submittedAt"`
+	ClaimedBy         *uuid.UUID `json:"claimedBy"`
+	ClaimedByUsername *string    `json:"claimedByUsername"`
+	ClaimExpiresAt    *time.Time `json:"claimExpiresAt"`
+	NoteCount         int        `json:"noteCount"`
+}
+
+func (r QueuedRice) ToDTO() QueuedRiceDTO {
+	if r.ClaimExpiresAt != nil {
+		*r.ClaimExpiresAt = r.ClaimExpiresAt.UTC()
+	}
+
+	return QueuedRiceDTO{
+		WaitingRiceDTO:    r.WaitingRice.ToDTO(),
+		SubmittedAt:       r.SubmittedAt.UTC(),
+		ClaimedBy:         r.ClaimedBy,
+		ClaimedByUsername: r.ClaimedByUsername,
+		ClaimExpiresAt:    r.ClaimExpiresAt,
+		NoteCount:         r.NoteCount,
+	}
+}
+
+func QueuedRicesToDTO(rices []QueuedRice) []QueuedRiceDTO {
+	dtos := make([]QueuedRiceDTO, len(rices))
+	for i, r := range rices {
+		dtos[i] = r.ToDTO()
+	}
+	return dtos
+}
+
+type RiceClaimDTO struct {
+	RiceID      uuid.UUID `json:"riceId"`
+	ModeratorID uuid.UUID `json:"moderatorId"`
+	ClaimedAt   time.Time `json:"claimedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func (c RiceClaim) ToDTO() RiceClaimDTO {
+	return RiceClaimDTO{
+		RiceID:      c.RiceID,
+		ModeratorID: c.ModeratorID,
+		ClaimedAt:   c.ClaimedAt.UTC(),
+		ExpiresAt:   c.ExpiresAt.UTC(),
+	}
+}
+
+type ReviewNoteDTO struct {
+	ID             uuid.UUID  `json:"id"`
+	AuthorID       *uuid.UUID `json:"authorId"`
+	AuthorUsername *string    `json:"authorUsername"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func (n ReviewNote) ToDTO() ReviewNoteDTO {
+	return ReviewNoteDTO{
+		ID:             n.ID,
+		AuthorID:       n.AuthorID,
+		AuthorUsername: n.AuthorUsername,
+		Content:        n.Content,
+		CreatedAt:      n.CreatedAt.UTC(),
+	}
+}
+
+func ReviewNotesToDTO(notes []ReviewNote) []ReviewNoteDTO {
+	dtos := make([]ReviewNoteDTO, len(notes))
+	for i, n := range notes {
+		dtos[i] = n.ToDTO()
+	}
+	return dtos
+}
+
 type ReportWithUserDTO struct {
-	ID          uuid.UUID  `json:"id"`
-	ReporterID  uuid.UUID  `json:"reporterId"`
-	DisplayName string     `json:"displayName"`
-	Username    string     `json:"username"`
-	Reason      string     `json:"reason"`
-	RiceID      *uuid.UUID `json:"riceId,omitempty"`
-	CommentID   *uuid.UUID `json:"commentId,omitempty"`
-	IsClosed    bool       `json:"isClosed"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	ID                uuid.UUID      `json:"id"`
+	ReporterID        *uuid.UUID     `json:"reporterId"`
+	DisplayName       *string        `json:"displayName"`
+	Username          *string        `json:"username"`
+	Reason            string         `json:"reason"`
+	Category          ReportCategory `json:"category"`
+	Status            ReportStatus   `json:"status"`
+	TargetType        ReportTarget   `json:"targetType"`
+	RiceID            *uuid.UUID     `json:"riceId,omitempty"`
+	CommentID         *uuid.UUID     `json:"commentId,omitempty"`
+	UserID            *uuid.UUID     `json:"userId,omitempty"`
+	PreviewID         *uuid.UUID     `json:"previewId,omitempty"`
+	ResolutionNote    *string        `json:"resolutionNote,omitempty"`
+	HandledBy         *uuid.UUID     `json:"handledBy,omitempty"`
+	HandledByUsername *string        `json:"handledByUsername,omitempty"`
+	ActionTaken       *ReportAction  `json:"actionTaken,omitempty"`
+	ResolvedAt        *time.Time     `json:"resolvedAt,omitempty"`
+	CreatedAt         time.Time      `json:"createdAt"`
 }
 
 func (r ReportWithUser) ToDTO() ReportWithUserDTO {
+	if r.ResolvedAt != nil {
+		*r.ResolvedAt = r.ResolvedAt.UTC()
+	}
+
 	return ReportWithUserDTO{
-		ID:          r.ID,
-		ReporterID:  r.ReporterID,
-		DisplayName: r.DisplayName,
-		Username:    r.Username,
-		Reason:      r.Reason,
-		RiceID:      r.RiceID,
-		CommentID:   r.CommentID,
-		IsClosed:    r.IsClosed,
-		CreatedAt:   r.CreatedAt.UTC(),
+		ID:                r.ID,
+		ReporterID:        r.ReporterID,
+		DisplayName:       r.DisplayName,
+		Username:          r.Username,
+		Reason:            r.Reason,
+		Category:          r.Category,
+		Status:            r.Status,
+		TargetType:        r.TargetType,
+		RiceID:            r.RiceID,
+		CommentID:         r.CommentID,
+		UserID:            r.UserID,
+		PreviewID:         r.PreviewID,
+		ResolutionNote:    r.ResolutionNote,
+		HandledBy:         r.HandledBy,
+		HandledByUsername: r.HandledByUsername,
+		ActionTaken:       r.ActionTaken,
+		ResolvedAt:        r.ResolvedAt,
+		CreatedAt:         r.CreatedAt.UTC(),
 	}
 }
 
@@ -393,19 +895,150 @@ func ReportsToDTO(reports []ReportWithUser) []ReportWithUserDTO {
 	return dto
 }
 
+// Snapshot of the reported content so moderators don't have to open every resource
+type ReportSnapshotDTO struct {
+	Title             *string    `json:"title,omitempty"`
+	Slug              *string    `json:"slug,omitempty"`
+	Thumbnail         *string    `json:"thumbnail,omitempty"`
+	Content           *string    `json:"content,omitempty"`
+	RiceID            *uuid.UUID `json:"riceId,omitempty"`
+	AuthorUsername    *string    `json:"authorUsername,omitempty"`
+	AuthorDisplayName *string    `json:"authorDisplayName,omitempty"`
+	AuthorAvatar      *string    `json:"authorAvatar,omitempty"`
+}
+
+type ReportedTargetDTO struct {
+	TargetType      ReportTarget      `json:"targetType"`
+	TargetID        uuid.UUID         `json:"targetId"`
+	ReportCount     int               `json:"reportCount"`
+	ReporterCount   int               `json:"reporterCount"`
+	Categories      []string          `json:"categories"`
+	FirstReportedAt time.Time         `json:"firstReportedAt"`
+	LastReportedAt  time.Time         `json:"lastReportedAt"`
+	Snapshot        ReportSnapshotDTO `json:"snapshot"`
+}
+
+func (t ReportedTarget) ToDTO() ReportedTargetDTO {
+	var thumbnail *string
+	if t.RiceThumbnail != nil {
+		url := utils.Config.CDNUrl + *t.RiceThumbnail
+		thumbnail = &url
+	}
+
+	var avatar *string
+	if t.AuthorUsername != nil {
+		url := utils.GetUserAvatar(t.AuthorAvatarPath)
+		avatar = &url
+	}
+
+	return ReportedTargetDTO{
+		TargetType:      t.TargetType,
+		TargetID:        t.TargetID,
+		ReportCount:     t.ReportCount,
+		ReporterCount:   t.ReporterCount,
+		Categories:      t.Categories,
+		FirstReportedAt: t.FirstReportedAt.UTC(),
+		LastReportedAt:  t.LastReportedAt.UTC(),
+		Snapshot: ReportSnapshotDTO{
+			Title:             t.RiceTitle,
+			Slug:              t.RiceSlug,
+			Thumbnail:         thumbnail,
+			Content:           t.CommentContent,
+			RiceID:            t.CommentRiceID,
+			AuthorUsername:    t.AuthorUsername,
+			AuthorDisplayName: t.AuthorDisplayName,
+			AuthorAvatar:      avatar,
+		},
+	}
+}
+
+func ReportedTargetsToDTO(targets []ReportedTarget) []ReportedTargetDTO {
+	dtos := make([]ReportedTargetDTO, len(targets))
+	for i, t := range targets {
+		dtos[i] = t.ToDTO()
+	}
+	return dtos
+}
+
+type LoginLockoutDTO struct {
+	ID             uuid.UUID         `json:"id"`
+	Scope          LoginLockoutScope `json:"scope"`
+	Username       *string           `json:"username"`
+	UserID         *uuid.UUID        `json:"userId"`
+	IP             string            `json:"ip"`
+	FailedAttempts int               `json:"failedAttempts"`
+	LockedUntil    time.Time         `json:"lockedUntil"`
+	CreatedAt      time.Time         `json:"createdAt"`
+}
+
+func (l LoginLockout) ToDTO() LoginLockoutDTO {
+	return LoginLockoutDTO{
+		ID:             l.ID,
+		Scope:          l.Scope,
+		Username:       l.Username,
+		UserID:         l.UserID,
+		IP:             l.IP,
+		FailedAttempts: l.FailedAttempts,
+		LockedUntil:    l.LockedUntil.UTC(),
+		CreatedAt:      l.CreatedAt.UTC(),
+	}
+}
+
+func LoginLockoutsToDTO(lockouts []LoginLockout) []LoginLockoutDTO {
+	dtos := make([]LoginLockoutDTO, len(lockouts))
+	for i, l := range lockouts {
+		dtos[i] = l.ToDTO()
+	}
+	return dtos
+}
+
 type ServiceStatisticsDTO struct {
-	UserCount       int `json:"userCount"`
-	User24hCount    int `json:"user24hCount"`
-	RiceCount       int `json:"riceCount"`
-	Rice24hCount    int `json:"rice24hCount"`
-	CommentCount    int `json:"commentCount"`
-	Comment24hCount int `json:"comment24hCount"`
-	ReportCount     int `json:"reportCount"`
-	OpenReportCount int `json:"openReportCount"`
+	UserCount           int                      `json:"userCount"`
+	User24hCount        int                      `json:"user24hCount"`
+	RiceCount           int                      `json:"riceCount"`
+	Rice24hCount        int                      `json:"rice24hCount"`
+	CommentCount        int                      `json:"commentCount"`
+	Comment24hCount     int                      `json:"comment24hCount"`
+	ReportCount         int                      `json:"reportCount"`
+	OpenReportCount     int                      `json:"openReportCount"`
+	WaitingRiceCount    int                      `json:"waitingRiceCount"`
+	MedianReviewSeconds float64                  `json:"medianReviewSeconds"`
+	Moderators          []ModeratorStatisticsDTO `json:"moderators"`
 }
 
 func (s ServiceStatistics) ToDTO() ServiceStatisticsDTO {
-	return ServiceStatisticsDTO(s)
+	moderators := make([]ModeratorStatisticsDTO, len(s.Moderators))
+	for i, m := range s.Moderators {
+		moderators[i] = m.ToDTO()
+	}
+
+	return ServiceStatisticsDTO{
+		UserCount:           s.UserCount,
+		User24hCount:        s.User24hCount,
+		RiceCount:           s.RiceCount,
+		Rice24hCount:        s.Rice24hCount,
+		CommentCount:        s.CommentCount,
+		Comment24hCount:     s.Comment24hCount,
+		ReportCount:         s.ReportCount,
+		OpenReportCount:     s.OpenReportCount,
+		WaitingRiceCount:    s.WaitingRiceCount,
+		MedianReviewSeconds: s.MedianReviewSeconds,
+		Moderators:          moderators,
+	}
+}
+
+type ModeratorStatisticsDTO struct {
+	ModeratorID         uuid.UUID `json:"moderatorId"`
+	Username            string    `json:"username"`
+	DisplayName         string    `json:"displayName"`
+	ApprovedCount       int       `json:"approvedCount"`
+	RejectedCount       int       `json:"rejectedCount"`
+	Review7dCount       int       `json:"review7dCount"`
+	MedianReviewSeconds float64   `json:"medianReviewSeconds"`
+}
+
+func (m ModeratorStatistics) ToDTO() ModeratorStatisticsDTO {
+	return ModeratorStatisticsDTO(m)
 }
 
 type WebsiteVariableDTO struct {
@@ -434,11 +1067,24 @@ type UserBanDTO struct {
 	ID        uuid.UUID  `json:"id"`
 	UserID    uuid.UUID  `json:"userId"`
 	AdminID   uuid.UUID  `json:"adminId"`
+	Scope     BanScope   `json:"scope"`
 	Reason    string     `json:"reason"`
 	IsRevoked bool       `json:"isRevoked"`
 	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 	BannedAt  time.Time  `json:"bannedAt"`
 	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy *uuid.UUID `json:"revokedBy,omitempty"`
+
+	Appeal *BanAppealInfoDTO `json:"appeal,omitempty"`
+}
+
+type BanAppealInfoDTO struct {
+	Message    string       `json:"message"`
+	Status     AppealStatus `json:"status"`
+	AppealedAt time.Time    `json:"appealedAt"`
+	Response   *string      `json:"response,omitempty"`
+	ReviewedBy *uuid.UUID   `json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time   `json:"reviewedAt,omitempty"`
 }
 
 func (b UserBan) ToDTO() UserBanDTO {
@@ -449,14 +1095,220 @@ func (b UserBan) ToDTO() UserBanDTO {
 		*b.RevokedAt = b.RevokedAt.UTC()
 	}
 
-	return UserBanDTO{
+	dto := UserBanDTO{
 		ID:        b.ID,
 		UserID:    b.UserID,
 		AdminID:   b.AdminID,
+		Scope:     b.Scope,
 		Reason:    b.Reason,
 		IsRevoked: b.IsRevoked,
 		ExpiresAt: b.ExpiresAt,
 		BannedAt:  b.BannedAt.UTC(),
 		RevokedAt: b.RevokedAt,
+		RevokedBy: b.RevokedBy,
 	}
+
+	if b.AppealStatus != nil && b.AppealMessage != nil && b.AppealedAt != nil {
+		if b.AppealReviewedAt != nil {
+			*b.AppealReviewedAt = b.AppealReviewedAt.UTC()
+		}
+
+		dto.Appeal = &BanAppealInfoDTO{
+			Message:    *b.AppealMessage,
+			Status:     *b.AppealStatus,
+			AppealedAt: b.AppealedAt.UTC(),
+			Response:   b.AppealResponse,
+			ReviewedBy: b.AppealReviewedBy,
+			ReviewedAt: b.AppealReviewedAt,
+		}
+	}
+
+	return dto
+}
+
+type UserBanChangeDTO struct {
+	ID            uuid.UUID       `json:"id"`
+	AdminID       *uuid.UUID      `json:"adminId"`
+	AdminUsername *string         `json:"adminUsername"`
+	Action        BanChangeAction `json:"action"`
+	OldReason     *string         `json:"oldReason,omitempty"`
+	NewReason     *string         `json:"newReason,omitempty"`
+	OldExpiresAt  *time.Time      `json:"oldExpiresAt,omitempty"`
+	NewExpiresAt  *time.Time      `json:"newExpiresAt,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+func (c UserBanChange) ToDTO() UserBanChangeDTO {
+	if c.OldExpiresAt != nil {
+		*c.OldExpiresAt = c.OldExpiresAt.UTC()
+	}
+	if c.NewExpiresAt != nil {
+		*c.NewExpiresAt = c.NewExpiresAt.UTC()
+	}
+
+	return UserBanChangeDTO{
+		ID:            c.ID,
+		AdminID:       c.AdminID,
+		AdminUsername: c.AdminUsername,
+		Action:        c.Action,
+		OldReason:     c.OldReason,
+		NewReason:     c.NewReason,
+		OldExpiresAt:  c.OldExpiresAt,
+		NewExpiresAt:  c.NewExpiresAt,
+		CreatedAt:     c.CreatedAt.UTC(),
+	}
+}
+
+type UserBanWithChangesDTO struct {
+	Ban     UserBanDTO         `json:"ban"`
+	Changes []UserBanChangeDTO `json:"changes"`
+}
+
+func (b UserBanWithChanges) ToDTO() UserBanWithChangesDTO {
+	changes := make([]UserBanChangeDTO, len(b.Changes))
+	for i, c := range b.Changes {
+		changes[i] = c.ToDTO()
+	}
+
+	return UserBanWithChangesDTO{
+		Ban:     b.Ban.ToDTO(),
+		Changes: changes,
+	}
+}
+
+func UserBansWithChangesToDTO(bans []UserBanWithChanges) []UserBanWithChangesDTO {
+	arr := make([]UserBanWithChangesDTO, len(bans))
+	for i, b := range bans {
+		arr[i] = b.ToDTO()
+	}
+	return arr
+}
+
+type FilterRuleDTO struct {
+	ID        uuid.UUID      `json:"id"`
+	Pattern   string         `json:"pattern"`
+	Kind      FilterRuleKind `json:"kind"`
+	Action    FilterAction   `json:"action"`
+	Normalize bool           `json:"normalize"`
+	CreatedBy *uuid.UUID     `json:"createdBy"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+func (r FilterRule) ToDTO() FilterRuleDTO {
+	return FilterRuleDTO{
+		ID:        r.ID,
+		Pattern:   r.Pattern,
+		Kind:      r.Kind,
+		Action:    r.Action,
+		Normalize: r.Normalize,
+		CreatedBy: r.CreatedBy,
+		CreatedAt: r.CreatedAt.UTC(),
+		UpdatedAt: r.UpdatedAt.UTC(),
+	}
+}
+
+func FilterRulesToDTO(rules []FilterRule) []FilterRuleDTO {
+	arr := make([]FilterRuleDTO, len(rules))
+	for i, r := range rules {
+		arr[i] = r.ToDTO()
+	}
+	return arr
+}
+
+type IPBanDTO struct {
+	ID        uuid.UUID  `json:"id"`
+	Network   string     `json:"network"`
+	AdminID   *uuid.UUID `json:"adminId"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (b IPBan) ToDTO() IPBanDTO {
+	if b.ExpiresAt != nil {
+		*b.ExpiresAt = b.ExpiresAt.UTC()
+	}
+
+	return IPBanDTO{
+		ID:        b.ID,
+		Network:   b.Network,
+		AdminID:   b.AdminID,
+		Reason:    b.Reason,
+		ExpiresAt: b.ExpiresAt,
+		CreatedAt: b.CreatedAt.UTC(),
+	}
+}
+
+func IPBansToDTO(bans []IPBan) []IPBanDTO {
+	arr := make([]IPBanDTO, len(bans))
+	for i, b := range bans {
+		arr[i] = b.ToDTO()
+	}
+	return arr
+}
+
+type UserIPsDTO struct {
+	RegistrationIP *string    `json:"registrationIp"`
+	LastLoginIP    *string    `json:"lastLoginIp"`
+	LastLoginAt    *time.Time `json:"lastLoginAt"`
+}
+
+func (i UserIPs) ToDTO() UserIPsDTO {
+	if i.LastLoginAt != nil {
+		*i.LastLoginAt = i.LastLoginAt.UTC()
+	}
+
+	return UserIPsDTO{
+		RegistrationIP: i.RegistrationIP,
+		LastLoginIP:    i.LastLoginIP,
+		LastLoginAt:    i.LastLoginAt,
+	}
+}
+
+type LinkedAccountDTO struct {
+	User UserDTO    `json:"user"`
+	IPs  UserIPsDTO `json:"ips"`
+}
+
+type UserNetworkDTO struct {
+	IPs            UserIPsDTO         `json:"ips"`
+	LinkedAccounts []LinkedAccountDTO `json:"linkedAccounts"`
+}
+
+func NewUserNetworkDTO(ips UserIPs, linked []LinkedAccount) UserNetworkDTO {
+	accounts := make([]LinkedAccountDTO, len(linked))
+	for i, a := range linked {
+		accounts[i] = LinkedAccountDTO{
+			User: a.User.ToDTO(),
+			IPs:  a.UserIPs.ToDTO(),
+		}
+	}
+
+	return UserNetworkDTO{
+		IPs:            ips.ToDTO(),
+		LinkedAccounts: accounts,
+	}
+}
+
+type BanAppealDTO struct {
+	Username    string     `json:"username"`
+	DisplayName string     `json:"displayName"`
+	Ban         UserBanDTO `json:"ban"`
+}
+
+func (a BanAppeal) ToDTO() BanAppealDTO {
+	return BanAppealDTO{
+		Username:    a.Username,
+		DisplayName: a.DisplayName,
+		Ban:         a.UserBan.ToDTO(),
+	}
+}
+
+func BanAppealsToDTO(appeals []BanAppeal) []BanAppealDTO {
+	arr := make([]BanAppealDTO, len(appeals))
+	for i, a := range appeals {
+		arr[i] = a.ToDTO()
+	}
+	return arr
 }
@@ -2,14 +2,38 @@ package repository
 
 import "ricehub/src/models"
 
+// every decision made on a waiting rice together with how long it waited since (re)submission
+const reviewsCte = `
+reviews AS (
+    SELECT
+        h.changed_by,
+        h.new_state,
+        h.created_at AS reviewed_at,
+        h.created_at - coalesce((
+            SELECT max(w.created_at)
+            FROM rice_state_history w
+            WHERE
+                w.rice_id = h.rice_id
+                AND w.new_state = 'waiting'
+                AND w.created_at < h.created_at
+        ), r.created_at) AS review_time
+    FROM rice_state_history h
+    JOIN rices r ON r.id = h.rice_id
+    WHERE h.old_state = 'waiting' AND h.new_state IN ('accepted', 'rejected')
+)
+`
+
+// shadow banned users and their content are left out of every statistic
 const fetchStatsSql = `
-WITH user_stats AS (
+WITH ` + reviewsCte + `,
+user_stats AS (
     SELECT
         COUNT(*) AS user_count,
         COUNT(*) FILTER (
             WHERE created_at >= NOW() - INTERVAL '24 hours'
         ) AS user_24h_count
     FROM users
+    WHERE id NOT IN (SELECT user_id FROM shadow_banned_users)
 ),
 rice_stats AS (
     SELECT
@@ -18,6 +42,7 @@ rice_stats AS (
             WHERE created_at >= NOW() - INTERVAL '24 hours'
         ) AS rice_24h_count
     FROM rices
+    WHERE author_id NOT IN (SELECT user_id FROM shadow_banned_users)
 ),
 comment_stats AS (
     SELECT
@@ -26,20 +51,55 @@ comment_stats AS (
             WHERE created_at >= NOW() - INTERVAL '24 hours'
         ) AS comment_24h_count
     FROM rice_comments
+    WHERE author_id NOT IN (SELECT user_id FROM shadow_banned_users) AND deleted_at IS NULL
 ),
 report_stats AS (
     SELECT
         COUNT(*) AS report_count,
         COUNT(*) FILTER (
-            WHERE is_closed = false
+            WHERE status IN ('open', 'in_review')
         ) AS open_report_count
     FROM reports
+),
+-- median is computed only from the last 30 days so it reflects the current state of the queue
+review_stats AS (
+    SELECT
+        (SELECT COUNT(*) FROM rices WHERE state = 'waiting') AS waiting_rice_count,
+        coalesce(
+            percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(EPOCH FROM review_time)::float8),
+            0
+        ) AS median_review_seconds
+    FROM reviews
+    WHERE reviewed_at >= NOW() - INTERVAL '30 days'
 )
 SELECT *
-FROM user_stats, rice_stats, comment_stats, report_stats
+FROM user_stats, rice_stats, comment_stats, report_stats, review_stats
+`
+
+const fetchModeratorStatsSql = `
+WITH ` + reviewsCte + `
+SELECT
+    u.id AS moderator_id,
+    u.username,
+    u.display_name,
+    COUNT(*) FILTER (WHERE r.new_state = 'accepted') AS approved_count,
+    COUNT(*) FILTER (WHERE r.new_state = 'rejected') AS rejected_count,
+    COUNT(*) FILTER (
+        WHERE r.reviewed_at >= NOW() - INTERVAL '7 days'
+    ) AS review_7d_count,
+    percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(EPOCH FROM r.review_time)::float8) AS median_review_seconds
+FROM reviews r
+JOIN users u ON u.id = r.changed_by
+GROUP BY u.id, u.username, u.display_name
+ORDER BY COUNT(*) DESC
 `
 
 func FetchServiceStatistics() (stats models.ServiceStatistics, err error) {
 	stats, err = rowToStruct[models.ServiceStatistics](fetchStatsSql)
+	if err != nil {
+		return
+	}
+
+	stats.Moderators, err = rowsToStruct[models.ModeratorStatistics](fetchModeratorStatsSql)
 	return
 }
@@ -2,7 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"ricehub/src/models"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 const hasUserCommentSql = `
@@ -12,45 +18,283 @@ SELECT EXISTS (
 	WHERE id = $1 AND author_id = $2
 )
 `
-const riceCommentsSql = `
-SELECT c.id AS comment_id, c.content, c.created_at, c.updated_at, u.display_name, u.username, u.avatar_path, u.is_banned
+
+// Columns selected into CommentWithUser. replyFilter limits replies counted
+// towards reply_count and viewerArg is a placeholder of the caller's ID.
+// Content of deleted comments is only returned to moderators.
+func commentWithUserColumns(replyFilter string, viewerArg string, moderator bool) string {
+	content := "CASE WHEN c.deleted_at IS NULL THEN c.content ELSE '' END AS content"
+	mentions := "CASE WHEN c.deleted_at IS NULL THEN coalesce(m.mentions, '[]') ELSE '[]' END AS mentions"
+	if moderator {
+		content = "c.content"
+		mentions = "coalesce(m.mentions, '[]') AS mentions"
+	}
+
+	return fmt.Sprintf(`
+	c.id AS comment_id, c.parent_id, c.parent_id IS NULL AND c.depth > 0 AS parent_removed, %v, c.is_hidden, c.deleted_at IS NOT NULL AS is_deleted,
+	c.edited_at, c.created_at, c.updated_at, c.hidden_by_rice_author,
+	EXISTS (SELECT 1 FROM rices pr WHERE pr.pinned_comment_id = c.id) AS is_pinned,
+	u.display_name, u.username, u.avatar_path, u.is_banned,
+	(SELECT COUNT(*) FROM rice_comments r WHERE r.parent_id = c.id AND %v) AS reply_count,
+	coalesce(cr.reactions, '{}') AS reactions,
+	coalesce(cr.reaction_count, 0) AS reaction_count,
+	(SELECT own.reaction FROM comment_reactions own WHERE own.comment_id = c.id AND own.user_id = %v) AS own_reaction,
+	%v
+	`, content, replyFilter, viewerArg, mentions)
+}
+
+// joins mentions and reactions used by commentWithUserColumns
+const commentRelationsJoinSql = `
+LEFT JOIN LATERAL (
+	SELECT jsonb_agg(jsonb_build_object('user_id', mu.id, 'username', mu.username) ORDER BY mu.username) AS mentions
+	FROM comment_mentions cm
+	JOIN users mu ON mu.id = cm.user_id
+	WHERE cm.comment_id = c.id
+) m ON true
+LEFT JOIN LATERAL (
+	SELECT jsonb_object_agg(g.reaction, g.count) AS reactions, SUM(g.count)::int AS reaction_count
+	FROM (
+		SELECT reaction, COUNT(*) AS count
+		FROM comment_reactions
+		WHERE comment_id = c.id
+		GROUP BY reaction
+	) g
+) cr ON true
+`
+
+// top level comments of the rice with values they can be sorted by
+const rankedRootCommentsSql = `
+SELECT
+	c.id, c.created_at,
+	(SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id) AS reaction_count
 FROM rice_comments c
+WHERE c.rice_id = $1 AND c.parent_id IS NULL AND %v
+`
+
+// Only top level comments are paginated, replies are always returned on the same page
+// as their thread root, ordered from the oldest. Replies under hidden replies are still shown.
+const riceCommentsSql = `
+WITH RECURSIVE roots AS (
+	SELECT *
+	FROM (` + rankedRootCommentsSql + `) c
+	%[3]v
+	ORDER BY c.%[4]v %[5]v, c.id %[5]v
+	LIMIT %[6]v OFFSET %[7]v
+), threads AS (
+	SELECT id, id AS root_id
+	FROM roots
+	UNION ALL
+	SELECT c.id, t.root_id
+	FROM rice_comments c
+	JOIN threads t ON c.parent_id = t.id
+)
+SELECT %[2]v
+FROM threads t
+JOIN roots ro ON ro.id = t.root_id
+JOIN rice_comments c ON c.id = t.id
 JOIN users_with_ban_status u ON u.id = c.author_id
-WHERE rice_id = $1
-ORDER BY created_at DESC
+` + commentRelationsJoinSql + `
+WHERE %[1]v
+ORDER BY ro.%[4]v %[5]v, ro.id %[5]v, c.created_at, c.id
 `
+
+// deleted comments still shown because of their replies aren't counted towards the total
+const riceCommentCountSql = `
+SELECT
+	COUNT(*) FILTER (WHERE c.deleted_at IS NULL) AS total,
+	COUNT(*) FILTER (WHERE c.parent_id IS NULL) AS top_level
+FROM rice_comments c
+WHERE c.rice_id = $1 AND %v
+`
+
+// Counts visible top level comments placed before the thread containing given comment.
+// Returns no rows if the thread isn't visible.
+const commentPositionSql = `
+WITH RECURSIVE chain AS (
+	SELECT id, parent_id
+	FROM rice_comments
+	WHERE id = $3 AND rice_id = $1
+	UNION ALL
+	SELECT p.id, p.parent_id
+	FROM rice_comments p
+	JOIN chain ch ON p.id = ch.parent_id
+), ranked AS (` + rankedRootCommentsSql + `)
+SELECT COUNT(c.id)
+FROM chain ch
+JOIN ranked root ON root.id = ch.id
+LEFT JOIN ranked c ON (c.%[2]v, c.id) %[3]v (root.%[2]v, root.id)
+WHERE ch.parent_id IS NULL
+GROUP BY root.id
+`
+
+// first revision is saved together with the comment
 const insertCommentSql = `
-INSERT INTO rice_comments (rice_id, author_id, content)
-VALUES ($1, $2, $3)
-RETURNING *
+WITH inserted AS (
+	INSERT INTO rice_comments (rice_id, author_id, parent_id, depth, content)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING *
+), revision AS (
+	INSERT INTO comment_revisions (comment_id, content, edited_by, created_at)
+	SELECT id, content, author_id, created_at
+	FROM inserted
+)
+SELECT * FROM inserted
 `
 const fetchRecentCommentsSql = `
-SELECT c.id AS comment_id, c.content, c.created_at, c.updated_at, u.display_name, u.username, u.avatar_path, u.is_banned
-FROM rice_comments c
-JOIN users_with_ban_status u ON u.id = c.author_id
-ORDER BY c.created_at DESC
-LIMIT $1
+SELECT *
+FROM (
+	SELECT %v
+	FROM rice_comments c
+	JOIN users_with_ban_status u ON u.id = c.author_id
+	` + commentRelationsJoinSql + `
+) c
 `
 
 // deluxe version of find comment because it fetches username and slug too
 const findCommentByIdSql = `
-SELECT rc.*, r.slug AS rice_slug, u.username AS rice_author_username
+SELECT rc.*, r.slug AS rice_slug, r.author_id AS rice_author_id, u.username AS rice_author_username
 FROM rice_comments rc
 JOIN rices r ON r.id = rc.rice_id
 JOIN users u ON u.id = r.author_id
 WHERE rc.id = $1
 `
 const updateCommentSql = `
-UPDATE rice_comments SET content = $1 WHERE id = $2
-RETURNING *
+WITH updated AS (
+	UPDATE rice_comments SET content = $1, edited_at = now()
+	WHERE id = $2 AND deleted_at IS NULL
+	RETURNING *
+), revision AS (
+	INSERT INTO comment_revisions (comment_id, content, edited_by)
+	SELECT id, content, $3
+	FROM updated
+)
+SELECT * FROM updated
+`
+const restoreCommentSql = `
+UPDATE rice_comments SET is_hidden = false
+WHERE id = $1 AND is_hidden = true
+`
+
+const pinnedCommentSql = `
+SELECT %v
+FROM rices ri
+JOIN rice_comments c ON c.id = ri.pinned_comment_id
+JOIN users_with_ban_status u ON u.id = c.author_id
+` + commentRelationsJoinSql + `
+WHERE ri.id = $1 AND c.deleted_at IS NULL AND %v
 `
+
+const publicCommentSql = `
+SELECT %v
+FROM rice_comments c
+JOIN users_with_ban_status u ON u.id = c.author_id
+` + commentRelationsJoinSql + `
+WHERE c.id = $1 AND %v
+`
+
+// content is kept so moderators can still review deleted comments
 const deleteCommentSql = `
-DELETE FROM rice_comments
-WHERE id = $1
+UPDATE rice_comments SET deleted_at = now(), deleted_by = $2
+WHERE id = $1 AND deleted_at IS NULL
+`
+const deleteStaleMentionsSql = `
+DELETE FROM comment_mentions
+WHERE comment_id = $1 AND user_id NOT IN (SELECT id FROM users WHERE username = ANY($2::text[]::citext[]))
 `
 
-func InsertComment(riceID string, authorID string, content string) (c models.RiceComment, err error) {
-	c, err = rowToStruct[models.RiceComment](insertCommentSql, riceID, authorID, content)
+// returns only newly mentioned users that can be notified
+const insertMentionsSql = `
+WITH added AS (
+	INSERT INTO comment_mentions (comment_id, user_id)
+	SELECT $1, id
+	FROM users
+	WHERE username = ANY($2::text[]::citext[])
+	ON CONFLICT DO NOTHING
+	RETURNING user_id
+)
+SELECT a.user_id
+FROM added a
+JOIN users_with_ban_status u ON u.id = a.user_id
+WHERE u.is_banned = false
+`
+const commentRevisionsSql = `
+SELECT cr.id, cr.comment_id, cr.content, cr.edited_by, u.username AS editor_username, cr.created_at
+FROM comment_revisions cr
+LEFT JOIN users u ON u.id = cr.edited_by
+WHERE cr.comment_id = $1
+ORDER BY cr.created_at, cr.id
+`
+const upsertCommentReactionSql = `
+INSERT INTO comment_reactions (comment_id, user_id, reaction)
+VALUES ($1, $2, $3)
+ON CONFLICT (comment_id, user_id) DO UPDATE
+SET reaction = EXCLUDED.reaction, created_at = now()
+`
+
+type CommentSort string
+
+const (
+	NewestComments    CommentSort = "newest"
+	OldestComments    CommentSort = "oldest"
+	MostLikedComments CommentSort = "liked"
+)
+
+type CommentPagination struct {
+	Sort CommentSort
+	// LastID with LastCreatedAt or LastReactionCount (depending on sort)
+	// belong to the last top level comment from the previous page
+	LastID            *string
+	LastCreatedAt     time.Time
+	LastReactionCount int
+	// used instead of the cursor when jumping to the page with specific comment
+	Offset int
+}
+
+// Returns column the comments are sorted by, order direction and operator comparing comment with the cursor
+func (p *CommentPagination) order() (string, string, string) {
+	switch p.Sort {
+	case OldestComments:
+		return "created_at", "ASC", ">"
+	case MostLikedComments:
+		return "reaction_count", "DESC", "<"
+	default:
+		return "created_at", "DESC", "<"
+	}
+}
+
+// Returns value of the cursor matching the sort and whether it was provided
+func (p *CommentPagination) Cursor() (any, bool) {
+	if p.LastID == nil {
+		return nil, false
+	}
+
+	if p.Sort == MostLikedComments {
+		return p.LastReactionCount, p.LastReactionCount >= 0
+	}
+
+	return p.LastCreatedAt, !p.LastCreatedAt.IsZero()
+}
+
+// viewerArg is needed so shadow banned users can still see their own comments
+// and comments hidden by the rice author are still visible to both authors.
+// Deleted comments are kept in the listing only if someone replied to them.
+func visibleComment(alias string, viewerArg string) string {
+	return fmt.Sprintf(`
+		%[1]v.is_hidden = false AND %[2]v AND
+		(
+			%[1]v.hidden_by_rice_author = false OR %[1]v.author_id = %[3]v OR
+			EXISTS (SELECT 1 FROM rices hr WHERE hr.id = %[1]v.rice_id AND hr.author_id = %[3]v)
+		) AND
+		(%[1]v.deleted_at IS NULL OR EXISTS (SELECT 1 FROM rice_comments x WHERE x.parent_id = %[1]v.id))`,
+		alias,
+		notShadowBanned(alias+".author_id", viewerArg),
+		viewerArg,
+	)
+}
+
+// parentID is nil for top level comments
+func InsertComment(riceID string, authorID string, parentID *string, depth int, content string) (c models.RiceComment, err error) {
+	c, err = rowToStruct[models.RiceComment](insertCommentSql, riceID, authorID, parentID, depth, content)
 	return
 }
 
@@ -60,13 +304,73 @@ func HasUserCommentWithId(commentID string, userID string) (bool, error) {
 	return exists, err
 }
 
-func FetchRecentComments(limit int) (c []models.CommentWithUser, err error) {
-	c, err = rowsToStruct[models.CommentWithUser](fetchRecentCommentsSql, limit)
+// Fetches comments from every rice for moderators, including hidden ones
+func FetchRecentComments(pag *CommentPagination, limit int) (c []models.CommentWithUser, err error) {
+	column, ord, sign := pag.order()
+
+	args := []any{}
+	where := ""
+	if cursor, ok := pag.Cursor(); ok {
+		args = append(args, cursor, *pag.LastID)
+		where = fmt.Sprintf(" WHERE (c.%v, c.comment_id) %v ($1, $2)", column, sign)
+	}
+
+	query := fmt.Sprintf(fetchRecentCommentsSql, commentWithUserColumns("TRUE", "NULL", true)) + where +
+		fmt.Sprintf(" ORDER BY c.%v %v, c.comment_id %v LIMIT %v", column, ord, ord, limit)
+	c, err = rowsToStruct[models.CommentWithUser](query, args...)
+	return
+}
+
+func FetchCommentCount() (count int, err error) {
+	err = db.QueryRow(context.Background(), "SELECT COUNT(*) FROM rice_comments").Scan(&count)
+	return
+}
+
+func FetchCommentsByRiceId(riceID string, viewerID *string, pag *CommentPagination) (c []models.CommentWithUser, err error) {
+	column, ord, sign := pag.order()
+
+	args := []any{riceID, viewerID}
+	where := ""
+	if cursor, ok := pag.Cursor(); ok {
+		args = append(args, cursor, *pag.LastID)
+		where = fmt.Sprintf("WHERE (c.%v, c.id) %v ($3, $4)", column, sign)
+	}
+
+	query := fmt.Sprintf(
+		riceCommentsSql,
+		visibleComment("c", "$2"),
+		commentWithUserColumns(visibleComment("r", "$2"), "$2", false),
+		where,
+		column,
+		ord,
+		utils.Config.PaginationLimit,
+		pag.Offset,
+	)
+	c, err = rowsToStruct[models.CommentWithUser](query, args...)
 	return
 }
 
-func FetchCommentsByRiceId(riceID string) (c []models.CommentWithUser, err error) {
-	c, err = rowsToStruct[models.CommentWithUser](riceCommentsSql, riceID)
+// Returns number of all visible comments and how many of them are top level ones
+func FetchRiceCommentCount(riceID string, viewerID *string) (total int, topLevel int, err error) {
+	query := fmt.Sprintf(riceCommentCountSql, visibleComment("c", "$2"))
+	err = db.QueryRow(context.Background(), query, riceID, viewerID).Scan(&total, &topLevel)
+	return
+}
+
+// Finds how many top level comments come before the thread containing the comment.
+// Returns pgx.ErrNoRows if the comment doesn't belong to the rice or its thread is hidden.
+func FetchCommentPosition(riceID string, viewerID *string, commentID string, sort CommentSort) (pos int, err error) {
+	pag := CommentPagination{Sort: sort}
+	column, _, sign := pag.order()
+
+	// comments placed before the thread are on the opposite side of the cursor
+	before := ">"
+	if sign == ">" {
+		before = "<"
+	}
+
+	query := fmt.Sprintf(commentPositionSql, visibleComment("c", "$2"), column, before)
+	err = db.QueryRow(context.Background(), query, riceID, viewerID, commentID).Scan(&pos)
 	return
 }
 
@@ -75,12 +379,122 @@ func FindCommentById(commentID string) (c models.RiceCommentWithSlug, err error)
 	return
 }
 
-func UpdateComment(commentID string, content string) (c models.RiceComment, err error) {
-	c, err = rowToStruct[models.RiceComment](updateCommentSql, content, commentID)
+// Saves new content as the latest revision, deleted comments can't be edited
+func UpdateComment(commentID string, editorID string, content string) (c models.RiceComment, err error) {
+	c, err = rowToStruct[models.RiceComment](updateCommentSql, content, commentID, editorID)
 	return
 }
 
-func DeleteComment(commentID string) error {
-	_, err := db.Exec(context.Background(), deleteCommentSql, commentID)
+func FetchCommentRevisions(commentID string) (r []models.CommentRevision, err error) {
+	r, err = rowsToStruct[models.CommentRevision](commentRevisionsSql, commentID)
+	return
+}
+
+func HideComment(commentID string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), "UPDATE rice_comments SET is_hidden = true WHERE id = $1 AND is_hidden = false", commentID)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Makes automatically hidden comment visible again
+func RestoreComment(tx pgx.Tx, commentID string) (bool, error) {
+	cmd, err := tx.Exec(context.Background(), restoreCommentSql, commentID)
+	return cmd.RowsAffected() == 1, err
+}
+
+func DeleteComment(commentID string, deletedBy string) error {
+	_, err := db.Exec(context.Background(), deleteCommentSql, commentID, deletedBy)
+	return err
+}
+
+func UpsertCommentReaction(commentID string, userID string, reaction models.CommentReaction) error {
+	_, err := db.Exec(context.Background(), upsertCommentReactionSql, commentID, userID, reaction)
+	return err
+}
+
+func DeleteCommentReaction(commentID string, userID string) error {
+	_, err := db.Exec(
+		context.Background(),
+		"DELETE FROM comment_reactions WHERE comment_id = $1 AND user_id = $2",
+		commentID, userID,
+	)
 	return err
 }
+
+// Returns nil if the rice doesn't have a pinned comment or the viewer can't see it
+func FindPinnedComment(riceID string, viewerID *string) (*models.CommentWithUser, error) {
+	query := fmt.Sprintf(pinnedCommentSql, commentWithUserColumns(visibleComment("r", "$2"), "$2", false), visibleComment("c", "$2"))
+	c, err := rowToStruct[models.CommentWithUser](query, riceID, viewerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Finds the comment the way anonymous visitors see it.
+// Returns nil if it's not visible to everyone, e.g. its author is shadow banned.
+func FindPublicComment(commentID string) (*models.CommentWithUser, error) {
+	query := fmt.Sprintf(publicCommentSql, commentWithUserColumns(visibleComment("r", "NULL"), "NULL", false), visibleComment("c", "NULL"))
+	c, err := rowToStruct[models.CommentWithUser](query, commentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Pins the comment on its rice replacing the previously pinned one
+func PinComment(riceID string, commentID string) error {
+	_, err := db.Exec(context.Background(), "UPDATE rices SET pinned_comment_id = $2 WHERE id = $1", riceID, commentID)
+	return err
+}
+
+func UnpinComment(commentID string) error {
+	_, err := db.Exec(context.Background(), "UPDATE rices SET pinned_comment_id = NULL WHERE pinned_comment_id = $1", commentID)
+	return err
+}
+
+func SetCommentHiddenByRiceAuthor(commentID string, hidden bool) error {
+	_, err := db.Exec(context.Background(), "UPDATE rice_comments SET hidden_by_rice_author = $2 WHERE id = $1", commentID, hidden)
+	return err
+}
+
+func SetCommentsLocked(riceID string, locked bool) (bool, error) {
+	cmd, err := db.Exec(context.Background(), "UPDATE rices SET comments_locked = $2 WHERE id = $1", riceID, locked)
+	return cmd.RowsAffected() == 1, err
+}
+
+func AreCommentsLocked(riceID string) (locked bool, err error) {
+	err = db.QueryRow(context.Background(), "SELECT comments_locked FROM rices WHERE id = $1", riceID).Scan(&locked)
+	return
+}
+
+// Replaces users mentioned in the comment and returns IDs of those who weren't mentioned
+// in it before. Banned users are still saved as mentioned but they aren't returned.
+func ReplaceCommentMentions(commentID string, usernames []string) ([]string, error) {
+	ctx := context.Background()
+
+	tx, err := StartTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, deleteStaleMentionsSql, commentID, usernames); err != nil {
+		return nil, err
+	}
+
+	rows, _ := tx.Query(ctx, insertMentionsSql, commentID, usernames)
+	added, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	return added, tx.Commit(ctx)
+}
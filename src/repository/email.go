@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"ricehub/src/models"
+	"time"
+)
+
+// Emails are claimed by bumping next_attempt_at which works as a lease,
+// so other instances skip them while they're being sent and they're retried if the instance dies.
+const claimPendingEmailsSql = `
+UPDATE email_queue
+SET attempts = attempts + 1, next_attempt_at = now() + $2::interval
+WHERE id IN (
+	SELECT id FROM email_queue
+	WHERE status = 'pending' AND next_attempt_at <= now()
+	ORDER BY next_attempt_at
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *
+`
+
+// Verification is reset whenever the address changes
+const upsertUserEmailSql = `
+INSERT INTO user_emails (user_id, email)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET
+	email = EXCLUDED.email,
+	verified_at = CASE WHEN user_emails.email = EXCLUDED.email THEN user_emails.verified_at ELSE NULL END,
+	updated_at = now()
+RETURNING *
+`
+
+func EnqueueEmail(recipient string, template string, data map[string]any) error {
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	_, err := db.Exec(
+		context.Background(),
+		"INSERT INTO email_queue (recipient, template, data) VALUES ($1, $2, $3)",
+		recipient, template, data,
+	)
+	return err
+}
+
+// Returns at most limit emails due to be sent and locks them for lease duration
+func ClaimPendingEmails(limit int, lease time.Duration) (e []models.QueuedEmail, err error) {
+	e, err = rowsToStruct[models.QueuedEmail](claimPendingEmailsSql, limit, lease)
+	return
+}
+
+func MarkEmailSent(emailID string) error {
+	_, err := db.Exec(
+		context.Background(),
+		"UPDATE email_queue SET status = 'sent', sent_at = now(), last_error = NULL WHERE id = $1",
+		emailID,
+	)
+	return err
+}
+
+// Schedules another attempt at retryAt or gives up if it's nil
+func MarkEmailFailed(emailID string, sendErr string, retryAt *time.Time) error {
+	const query = `
+	UPDATE email_queue
+	SET
+		last_error = $2,
+		status = CASE WHEN $3::timestamptz IS NULL THEN 'failed'::email_status ELSE status END,
+		next_attempt_at = coalesce($3, next_attempt_at)
+	WHERE id = $1
+	`
+
+	_, err := db.Exec(context.Background(), query, emailID, sendErr, retryAt)
+	return err
+}
+
+func FindUserEmail(userID string) (e models.UserEmail, err error) {
+	e, err = rowToStruct[models.UserEmail]("SELECT * FROM user_emails WHERE user_id = $1", userID)
+	return
+}
+
+func UpsertUserEmail(userID string, email string) (e models.UserEmail, err error) {
+	e, err = rowToStruct[models.UserEmail](upsertUserEmailSql, userID, email)
+	return
+}
+
+func DeleteUserEmail(userID string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), "DELETE FROM user_emails WHERE user_id = $1", userID)
+	return cmd.RowsAffected() == 1, err
+}
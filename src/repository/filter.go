@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"ricehub/src/models"
+)
+
+// Imports words from the old config blacklist as rejecting word rules. It only happens
+// while there are no rules at all so rules removed by moderators are not brought back.
+// Returns how many rules were created.
+func ImportBlacklistedWords(words []string) (int64, error) {
+	const query = `
+	INSERT INTO content_filter_rules (pattern, kind, action, normalize)
+	SELECT DISTINCT lower(w), 'word'::filter_rule_kind, 'reject'::filter_rule_action, false
+	FROM unnest($1::text[]) w
+	WHERE NOT EXISTS (SELECT 1 FROM content_filter_rules)
+	ON CONFLICT (pattern, kind) DO NOTHING
+	`
+
+	cmd, err := db.Exec(context.Background(), query, words)
+	return cmd.RowsAffected(), err
+}
+
+func FetchFilterRules() (rules []models.FilterRule, err error) {
+	rules, err = rowsToStruct[models.FilterRule]("SELECT * FROM content_filter_rules ORDER BY created_at")
+	return
+}
+
+func FindFilterRule(ruleID string) (rule models.FilterRule, err error) {
+	rule, err = rowToStruct[models.FilterRule]("SELECT * FROM content_filter_rules WHERE id = $1", ruleID)
+	return
+}
+
+func InsertFilterRule(pattern string, kind models.FilterRuleKind, action models.FilterAction, normalize bool, createdBy string) (rule models.FilterRule, err error) {
+	const query = `
+	INSERT INTO content_filter_rules (pattern, kind, action, normalize, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING *
+	`
+
+	rule, err = rowToStruct[models.FilterRule](query, pattern, kind, action, normalize, createdBy)
+	return
+}
+
+func UpdateFilterRule(rule models.FilterRule) (updated models.FilterRule, err error) {
+	const query = `
+	UPDATE content_filter_rules
+	SET pattern = $2, kind = $3, action = $4, normalize = $5
+	WHERE id = $1
+	RETURNING *
+	`
+
+	updated, err = rowToStruct[models.FilterRule](query, rule.ID, rule.Pattern, rule.Kind, rule.Action, rule.Normalize)
+	return
+}
+
+func DeleteFilterRule(ruleID string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), "DELETE FROM content_filter_rules WHERE id = $1", ruleID)
+	return cmd.RowsAffected() == 1, err
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"ricehub/src/models"
+	"time"
+)
+
+const ipBanColumns = "id, network::text AS network, admin_id, reason, expires_at, created_at"
+
+// Finds active ban of any network that contains the address
+func FindActiveIPBan(ip string) (ban models.IPBan, err error) {
+	query := `
+	SELECT ` + ipBanColumns + `
+	FROM ip_bans
+	WHERE
+		network >>= $1::inet AND
+		(expires_at > NOW() OR expires_at IS NULL)
+	ORDER BY expires_at DESC NULLS FIRST
+	LIMIT 1
+	`
+
+	return rowToStruct[models.IPBan](query, ip)
+}
+
+func FetchActiveIPBans() (bans []models.IPBan, err error) {
+	query := `
+	SELECT ` + ipBanColumns + `
+	FROM ip_bans
+	WHERE expires_at > NOW() OR expires_at IS NULL
+	ORDER BY created_at DESC
+	`
+
+	return rowsToStruct[models.IPBan](query)
+}
+
+func InsertIPBan(network string, adminID string, reason string, expiresAt *time.Time) (ban models.IPBan, err error) {
+	query := `
+	INSERT INTO ip_bans (network, admin_id, reason, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + ipBanColumns
+
+	return rowToStruct[models.IPBan](query, network, adminID, reason, expiresAt)
+}
+
+func DeleteIPBan(banID string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), "DELETE FROM ip_bans WHERE id = $1", banID)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Saves address used to log in, the row is created if user registered before addresses were recorded
+func UpdateLastLoginIP(userID string, ip string) error {
+	const query = `
+	INSERT INTO user_ips (user_id, last_login_ip, last_login_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (user_id) DO UPDATE
+	SET last_login_ip = EXCLUDED.last_login_ip, last_login_at = EXCLUDED.last_login_at
+	`
+
+	_, err := db.Exec(context.Background(), query, userID, ip)
+	return err
+}
+
+func FindUserIPs(userID string) (ips models.UserIPs, err error) {
+	const query = `
+	SELECT host(registration_ip) AS registration_ip, host(last_login_ip) AS last_login_ip, last_login_at
+	FROM user_ips
+	WHERE user_id = $1
+	`
+
+	return rowToStruct[models.UserIPs](query, userID)
+}
+
+// Fetches other accounts that registered or logged in from any of the user's addresses
+func FetchLinkedAccounts(userID string) (accounts []models.LinkedAccount, err error) {
+	const query = `
+	SELECT
+		u.*,
+		host(other.registration_ip) AS registration_ip,
+		host(other.last_login_ip) AS last_login_ip,
+		other.last_login_at
+	FROM user_ips me
+	JOIN user_ips other ON
+		other.user_id != me.user_id AND (
+			other.registration_ip IN (me.registration_ip, me.last_login_ip) OR
+			other.last_login_ip IN (me.registration_ip, me.last_login_ip)
+		)
+	JOIN users_with_ban_status u ON u.id = other.user_id
+	WHERE me.user_id = $1
+	ORDER BY u.created_at DESC
+	`
+
+	return rowsToStruct[models.LinkedAccount](query, userID)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"ricehub/src/models"
+	"time"
+)
+
+// user_id is filled in only if the username exists
+const insertLoginLockoutSql = `
+INSERT INTO login_lockouts (scope, username, user_id, ip, failed_attempts, locked_until)
+VALUES ($1, $2, (SELECT id FROM users WHERE username = $2), $3, $4, now() + $5::interval)
+`
+
+const fetchLoginLockoutsSql = `
+SELECT id, scope, username, user_id, host(ip) AS ip, failed_attempts, locked_until, created_at
+FROM login_lockouts
+ORDER BY created_at DESC
+LIMIT $1
+`
+
+// username is nil for lockouts of IP addresses
+func InsertLoginLockout(scope models.LoginLockoutScope, username *string, ip string, failedAttempts int64, duration time.Duration) error {
+	_, err := db.Exec(context.Background(), insertLoginLockoutSql, scope, username, ip, failedAttempts, duration)
+	return err
+}
+
+func FetchLoginLockouts(limit uint) (l []models.LoginLockout, err error) {
+	l, err = rowsToStruct[models.LoginLockout](fetchLoginLockoutsSql, limit)
+	return
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ricehub/src/models"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// waiting rices with their duplicate flags, claims and time of (re)submission
+const queueBaseSql = `
+WITH queue AS (
+	SELECT
+		r.id, r.title, r.slug, r.created_at, r.state,
+		u.display_name, u.username,
+		p.file_path AS thumbnail,
+		0 AS star_count,
+		0 AS comment_count,
+		0 AS download_count,
+		0 AS score,
+		false AS is_starred,
+		coalesce((
+			SELECT jsonb_agg(jsonb_build_object(
+				'preview_id', dp.id,
+				'preview_path', dp.file_path,
+				'original_preview_path', op.file_path,
+				'original_rice_id', orice.id,
+				'original_rice_title', orice.title,
+				'original_rice_slug', orice.slug,
+				'original_author_username', ou.username,
+				'distance', d.distance
+			) ORDER BY d.distance)
+			FROM rice_preview_duplicates d
+			JOIN rice_previews dp ON dp.id = d.preview_id
+			JOIN rice_previews op ON op.id = d.original_preview_id
+			JOIN rices orice ON orice.id = op.rice_id
+			JOIN users ou ON ou.id = orice.author_id
+			WHERE dp.rice_id = r.id
+		), '[]'::jsonb) AS duplicates,
+		coalesce(sub.submitted_at, r.created_at) AS submitted_at,
+		cl.moderator_id AS claimed_by,
+		cu.username AS claimed_by_username,
+		cl.expires_at AS claim_expires_at,
+		(SELECT count(*) FROM rice_review_notes n WHERE n.rice_id = r.id) AS note_count
+	FROM rices r
+	JOIN users u ON u.id = r.author_id
+	JOIN LATERAL (
+		SELECT p.file_path
+		FROM rice_previews p
+		WHERE p.rice_id = r.id
+		ORDER BY p.created_at
+		LIMIT 1
+	) p ON TRUE
+	LEFT JOIN LATERAL (
+		SELECT max(h.created_at) AS submitted_at
+		FROM rice_state_history h
+		WHERE h.rice_id = r.id AND h.new_state = 'waiting'
+	) sub ON TRUE
+	LEFT JOIN rice_review_claims cl ON cl.rice_id = r.id AND cl.expires_at > now()
+	LEFT JOIN users cu ON cu.id = cl.moderator_id
+	WHERE r.state = 'waiting'
+)
+SELECT * FROM queue
+`
+
+// claim can be taken over only if it expired or belongs to the same moderator
+const claimRiceSql = `
+INSERT INTO rice_review_claims (rice_id, moderator_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (rice_id) DO UPDATE
+SET moderator_id = EXCLUDED.moderator_id, expires_at = EXCLUDED.expires_at, claimed_at = now()
+WHERE rice_review_claims.expires_at <= now() OR rice_review_claims.moderator_id = EXCLUDED.moderator_id
+RETURNING *
+`
+
+const findActiveClaimSql = `
+SELECT *
+FROM rice_review_claims
+WHERE rice_id = $1 AND expires_at > now()
+`
+
+const insertReviewNoteSql = `
+WITH note AS (
+	INSERT INTO rice_review_notes (rice_id, author_id, content)
+	VALUES ($1, $2, $3)
+	RETURNING *
+)
+SELECT n.id, n.rice_id, n.author_id, u.username AS author_username, n.content, n.created_at
+FROM note n
+LEFT JOIN users u ON u.id = n.author_id
+`
+
+const fetchReviewNotesSql = `
+SELECT n.id, n.rice_id, n.author_id, u.username AS author_username, n.content, n.created_at
+FROM rice_review_notes n
+LEFT JOIN users u ON u.id = n.author_id
+WHERE n.rice_id = $1
+ORDER BY n.created_at
+`
+
+type QueueFilter struct {
+	// only show rices submitted before this time (i.e. at least X old)
+	SubmittedBefore *time.Time
+	// only show rices submitted after this time (i.e. at most X old)
+	SubmittedAfter *time.Time
+	// hide rices claimed by moderators other than this one
+	UnclaimedFor *string
+	// cursor pagination, LastID is validated in the handler
+	LastID          *string
+	LastSubmittedAt time.Time
+}
+
+// Builds WHERE clause of the queue, the cursor is left out when counting all matching rices
+func (filter *QueueFilter) where(withCursor bool) (string, []any) {
+	where := " WHERE true"
+	args := []any{}
+
+	if filter.SubmittedBefore != nil {
+		args = append(args, *filter.SubmittedBefore)
+		where += fmt.Sprintf(" AND submitted_at <= $%v", len(args))
+	}
+	if filter.SubmittedAfter != nil {
+		args = append(args, *filter.SubmittedAfter)
+		where += fmt.Sprintf(" AND submitted_at >= $%v", len(args))
+	}
+	if filter.UnclaimedFor != nil {
+		args = append(args, *filter.UnclaimedFor)
+		where += fmt.Sprintf(" AND (claimed_by IS NULL OR claimed_by = $%v)", len(args))
+	}
+	if withCursor && filter.LastID != nil && !filter.LastSubmittedAt.IsZero() {
+		args = append(args, filter.LastSubmittedAt, *filter.LastID)
+		where += fmt.Sprintf(" AND (submitted_at, id) > ($%v, $%v)", len(args)-1, len(args))
+	}
+
+	return where, args
+}
+
+// Fetches a page of waiting rices, oldest submissions first
+func FetchModerationQueue(filter *QueueFilter) (r []models.QueuedRice, err error) {
+	where, args := filter.where(true)
+	query := queueBaseSql + where + fmt.Sprintf(" ORDER BY submitted_at, id LIMIT %v", utils.Config.PaginationLimit)
+	r, err = rowsToStruct[models.QueuedRice](query, args...)
+	return
+}
+
+// Counts waiting rices matching the filter on all pages
+func CountModerationQueue(filter *QueueFilter) (count int, err error) {
+	where, args := filter.where(false)
+	query := "SELECT count(*) FROM (" + queueBaseSql + where + ") q"
+	err = db.QueryRow(context.Background(), query, args...).Scan(&count)
+	return
+}
+
+// Claims the rice for the moderator. Returns pgx.ErrNoRows if it's already claimed by someone else.
+func ClaimRice(riceID string, moderatorID string, expiresAt time.Time) (claim models.RiceClaim, err error) {
+	claim, err = rowToStruct[models.RiceClaim](claimRiceSql, riceID, moderatorID, expiresAt)
+	return
+}
+
+func FindActiveClaim(riceID string) (claim models.RiceClaim, err error) {
+	claim, err = rowToStruct[models.RiceClaim](findActiveClaimSql, riceID)
+	return
+}
+
+func ReleaseClaim(riceID string, moderatorID string) (bool, error) {
+	cmd, err := db.Exec(
+		context.Background(),
+		"DELETE FROM rice_review_claims WHERE rice_id = $1 AND moderator_id = $2",
+		riceID, moderatorID,
+	)
+	return cmd.RowsAffected() == 1, err
+}
+
+// claim is no longer needed once the rice leaves the queue
+func DeleteRiceClaim(tx pgx.Tx, riceID string) error {
+	_, err := tx.Exec(context.Background(), "DELETE FROM rice_review_claims WHERE rice_id = $1", riceID)
+	return err
+}
+
+func InsertReviewNote(riceID string, authorID string, content string) (n models.ReviewNote, err error) {
+	n, err = rowToStruct[models.ReviewNote](insertReviewNoteSql, riceID, authorID, content)
+	return
+}
+
+func FetchReviewNotes(riceID string) (n []models.ReviewNote, err error) {
+	n, err = rowsToStruct[models.ReviewNote](fetchReviewNotesSql, riceID)
+	return
+}
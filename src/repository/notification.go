@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ricehub/src/models"
+	"ricehub/src/utils"
+	"time"
+)
+
+// columns of models.Notification, "n" has to be a notifications row
+const notificationColumnsSql = `
+SELECT
+	n.id, n.user_id, n.type, n.actor_id, n.rice_id, n.comment_id, n.data, n.read_at, n.created_at,
+	a.username AS actor_username, a.display_name AS actor_display_name, a.avatar_path AS actor_avatar_path,
+	r.title AS rice_title, r.slug AS rice_slug, ra.username AS rice_author_username
+`
+const notificationJoinsSql = `
+LEFT JOIN users a ON a.id = n.actor_id
+LEFT JOIN rices r ON r.id = n.rice_id
+LEFT JOIN users ra ON ra.id = r.author_id
+`
+
+// Types the user turned off are skipped. With dedupe the notification is also skipped
+// when an identical one is still unread, so starring the same rice over and over doesn't spam the author.
+const insertNotificationSql = `
+WITH n AS (
+	INSERT INTO notifications (user_id, type, actor_id, rice_id, comment_id, data)
+	SELECT $1::uuid, $2::notification_type, $3::uuid, $4::uuid, $5::uuid, $6::jsonb
+	WHERE NOT EXISTS (
+		SELECT 1 FROM notification_preferences
+		WHERE user_id = $1 AND type = $2 AND enabled = false
+	) AND NOT (
+		$7::bool AND EXISTS (
+			SELECT 1 FROM notifications
+			WHERE user_id = $1 AND type = $2 AND read_at IS NULL
+				AND actor_id IS NOT DISTINCT FROM $3
+				AND rice_id IS NOT DISTINCT FROM $4
+				AND comment_id IS NOT DISTINCT FROM $5
+		)
+	)
+	RETURNING *
+)` + notificationColumnsSql + "FROM n" + notificationJoinsSql
+
+const fetchNotificationsSql = notificationColumnsSql + "FROM notifications n" + notificationJoinsSql + "WHERE n.user_id = $1"
+
+// every type is returned, those without a saved preference are enabled
+const fetchNotificationPreferencesSql = `
+SELECT t AS type, COALESCE(p.enabled, true) AS enabled
+FROM unnest(enum_range(NULL::notification_type)) t
+LEFT JOIN notification_preferences p ON p.type = t AND p.user_id = $1
+ORDER BY t
+`
+
+const upsertNotificationPreferencesSql = `
+INSERT INTO notification_preferences (user_id, type, enabled)
+SELECT $1, p.type, p.enabled
+FROM unnest($2::text[]::notification_type[], $3::bool[]) AS p(type, enabled)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+`
+
+// actorID, riceID and commentID are optional depending on the notification type.
+// Returns pgx.ErrNoRows if the notification was skipped.
+func InsertNotification(userID string, notifType models.NotificationType, actorID *string, riceID *string, commentID *string, data map[string]any, dedupe bool) (n models.Notification, err error) {
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	n, err = rowToStruct[models.Notification](insertNotificationSql, userID, notifType, actorID, riceID, commentID, data, dedupe)
+	return
+}
+
+// Returns newest notifications first, lastID and lastCreatedAt point to the last notification of previous page
+func FetchNotifications(userID string, unreadOnly bool, lastID *string, lastCreatedAt *time.Time) (n []models.Notification, err error) {
+	args := []any{userID}
+	query := fetchNotificationsSql
+
+	if unreadOnly {
+		query += " AND n.read_at IS NULL"
+	}
+	if lastID != nil && lastCreatedAt != nil {
+		args = append(args, *lastCreatedAt, *lastID)
+		query += fmt.Sprintf(" AND (n.created_at, n.id) < ($%v, $%v)", len(args)-1, len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY n.created_at DESC, n.id DESC LIMIT %v", utils.Config.PaginationLimit)
+	n, err = rowsToStruct[models.Notification](query, args...)
+	return
+}
+
+func FetchUnreadNotificationCount(userID string) (count int, err error) {
+	const query = "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+	err = db.QueryRow(context.Background(), query, userID).Scan(&count)
+	return
+}
+
+// Returns false if the user has no notification with provided ID
+func MarkNotificationRead(notificationID string, userID string) (bool, error) {
+	const query = "UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2"
+	cmd, err := db.Exec(context.Background(), query, notificationID, userID)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Returns how many notifications were marked as read
+func MarkAllNotificationsRead(userID string) (int64, error) {
+	const query = "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL"
+	cmd, err := db.Exec(context.Background(), query, userID)
+	return cmd.RowsAffected(), err
+}
+
+func FetchNotificationPreferences(userID string) (p []models.NotificationPreference, err error) {
+	p, err = rowsToStruct[models.NotificationPreference](fetchNotificationPreferencesSql, userID)
+	return
+}
+
+func UpdateNotificationPreferences(userID string, prefs []models.NotificationPreference) error {
+	types := make([]string, len(prefs))
+	enabled := make([]bool, len(prefs))
+	for i, p := range prefs {
+		types[i] = string(p.Type)
+		enabled[i] = p.Enabled
+	}
+
+	_, err := db.Exec(context.Background(), upsertNotificationPreferencesSql, userID, types, enabled)
+	return err
+}
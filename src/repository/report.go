@@ -2,37 +2,208 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"ricehub/src/models"
+	"ricehub/src/utils"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
+// preview reports also reference the rice that the preview belongs to
 const insertReportSql = `
-INSERT INTO reports (reporter_id, reason, rice_id, comment_id)
-VALUES ($1, $2, $3, $4)
+INSERT INTO reports (reporter_id, category, reason, target_type, rice_id, comment_id, user_id, preview_id)
+VALUES (
+	$1, $2, $3, $4,
+	coalesce($5, (SELECT rice_id FROM rice_previews WHERE id = $8)),
+	$6, $7, $8
+)
 RETURNING id
 `
+
 const fetchReportsSql = `
-SELECT r.*, u.display_name, u.username
+SELECT r.*, u.display_name, u.username, h.username AS handled_by_username
 FROM reports r
-JOIN users u ON u.id = r.reporter_id
-ORDER BY r.created_at DESC
+LEFT JOIN users u ON u.id = r.reporter_id
+LEFT JOIN users h ON h.id = r.handled_by
 `
+
+// reported resources with a snapshot of their content, reports are filtered before grouping
+func buildFetchReportedTargetsSql(where string) string {
+	return `
+	WITH grouped AS (
+		SELECT
+			r.target_type,
+			coalesce(r.preview_id, r.comment_id, r.user_id, r.rice_id) AS target_id,
+			count(*) AS report_count,
+			count(DISTINCT r.reporter_id) AS reporter_count,
+			array_agg(DISTINCT r.category::text) AS categories,
+			min(r.created_at) AS first_reported_at,
+			max(r.created_at) AS last_reported_at
+		FROM reports r
+		` + where + `
+		GROUP BY 1, 2
+	)
+	SELECT
+		g.*,
+		ri.title AS rice_title,
+		ri.slug AS rice_slug,
+		coalesce(pv.file_path, thumb.file_path) AS rice_thumbnail,
+		co.content AS comment_content,
+		coalesce(co.rice_id, pv.rice_id) AS comment_rice_id,
+		au.username AS author_username,
+		au.display_name AS author_display_name,
+		au.avatar_path AS author_avatar_path
+	FROM grouped g
+	LEFT JOIN rice_previews pv ON g.target_type = 'preview' AND pv.id = g.target_id
+	LEFT JOIN rices ri ON (g.target_type = 'rice' AND ri.id = g.target_id) OR ri.id = pv.rice_id
+	LEFT JOIN rice_comments co ON g.target_type = 'comment' AND co.id = g.target_id
+	LEFT JOIN users au ON au.id = coalesce(ri.author_id, co.author_id, CASE WHEN g.target_type = 'user' THEN g.target_id END)
+	LEFT JOIN LATERAL (
+		SELECT p.file_path
+		FROM rice_previews p
+		WHERE p.rice_id = ri.id
+		ORDER BY p.created_at
+		LIMIT 1
+	) thumb ON TRUE
+	`
+}
+
 const findReportSql = `
-SELECT r.*, u.display_name, u.username
+SELECT r.*, u.display_name, u.username, h.username AS handled_by_username
 FROM reports r
-JOIN users u ON u.id = r.reporter_id
+LEFT JOIN users u ON u.id = r.reporter_id
+LEFT JOIN users h ON h.id = r.handled_by
 WHERE r.id = $1
 `
-const setIsClosedSql = `UPDATE reports SET is_closed = $1 WHERE id = $2`
 
-func InsertReport(reporterID string, reason string, riceID *string, commentID *string) (id uuid.UUID, err error) {
-	err = db.QueryRow(context.Background(), insertReportSql, reporterID, reason, riceID, commentID).Scan(&id)
+// resolved_at is only set when the report gets closed and cleared if it's reopened
+const updateReportStatusSql = `
+UPDATE reports
+SET
+	status = $2,
+	handled_by = $3,
+	resolution_note = coalesce($4, resolution_note),
+	action_taken = $5,
+	resolved_at = CASE WHEN $2 IN ('resolved', 'dismissed') THEN now() ELSE NULL END
+WHERE id = $1
+`
+
+// every distinct reporter with an open report adds up to 1 point depending on their account age
+const fetchReportScoreSql = `
+SELECT coalesce(sum(LEAST(1, extract(epoch FROM now() - u.created_at) / $3)), 0)
+FROM (
+	SELECT DISTINCT reporter_id
+	FROM reports
+	WHERE target_type = $1
+		AND coalesce(preview_id, comment_id, user_id, rice_id) = $2
+		AND status IN ('open', 'in_review')
+) r
+JOIN users u ON u.id = r.reporter_id
+`
+
+const dismissOpenReportsSql = `
+UPDATE reports
+SET
+	status = 'dismissed',
+	handled_by = $3,
+	resolution_note = $4,
+	action_taken = 'none',
+	resolved_at = now()
+WHERE target_type = $1
+	AND coalesce(preview_id, comment_id, user_id, rice_id) = $2
+	AND status IN ('open', 'in_review')
+`
+
+type ReportTargetIDs struct {
+	RiceID    *string
+	CommentID *string
+	UserID    *string
+	PreviewID *string
+}
+
+// reporterID is nil for reports created automatically by the content filter
+func InsertReport(reporterID *string, category models.ReportCategory, reason string, targetType models.ReportTarget, ids ReportTargetIDs) (id uuid.UUID, err error) {
+	err = db.QueryRow(
+		context.Background(), insertReportSql,
+		reporterID, category, reason, targetType,
+		ids.RiceID, ids.CommentID, ids.UserID, ids.PreviewID,
+	).Scan(&id)
 	return
 }
 
-func FetchReports() (r []models.ReportWithUser, err error) {
-	r, err = rowsToStruct[models.ReportWithUser](fetchReportsSql)
+type ReportFilter struct {
+	Status     *string
+	Category   *string
+	TargetType *string
+	From       *time.Time
+	To         *time.Time
+
+	// cursor of the report list, LastID is validated in the handler
+	LastID        *string
+	LastCreatedAt time.Time
+
+	// cursor of the grouped list, both parts are validated in the handler
+	LastTargetID    *string
+	LastReportCount int
+}
+
+// Builds WHERE clause shared by both report lists and appends its arguments
+func buildReportFilters(filter *ReportFilter, args *[]any) string {
+	where := " WHERE true"
+
+	if filter.Status != nil {
+		*args = append(*args, *filter.Status)
+		where += fmt.Sprintf(" AND r.status = $%v", len(*args))
+	}
+	if filter.Category != nil {
+		*args = append(*args, *filter.Category)
+		where += fmt.Sprintf(" AND r.category = $%v", len(*args))
+	}
+	if filter.TargetType != nil {
+		*args = append(*args, *filter.TargetType)
+		where += fmt.Sprintf(" AND r.target_type = $%v", len(*args))
+	}
+	if filter.From != nil {
+		*args = append(*args, *filter.From)
+		where += fmt.Sprintf(" AND r.created_at >= $%v", len(*args))
+	}
+	if filter.To != nil {
+		*args = append(*args, *filter.To)
+		where += fmt.Sprintf(" AND r.created_at <= $%v", len(*args))
+	}
+
+	return where
+}
+
+func FetchReports(filter *ReportFilter) (r []models.ReportWithUser, err error) {
+	args := []any{}
+	where := buildReportFilters(filter, &args)
+
+	if filter.LastID != nil && !filter.LastCreatedAt.IsZero() {
+		args = append(args, filter.LastCreatedAt, *filter.LastID)
+		where += fmt.Sprintf(" AND (r.created_at, r.id) < ($%v, $%v)", len(args)-1, len(args))
+	}
+
+	query := fetchReportsSql + where + fmt.Sprintf(" ORDER BY r.created_at DESC, r.id DESC LIMIT %v", utils.Config.PaginationLimit)
+	r, err = rowsToStruct[models.ReportWithUser](query, args...)
+	return
+}
+
+// Fetches reported resources ordered from the most reported ones
+func FetchReportedTargets(filter *ReportFilter) (t []models.ReportedTarget, err error) {
+	args := []any{}
+	where := buildReportFilters(filter, &args)
+	query := buildFetchReportedTargetsSql(where)
+
+	if filter.LastTargetID != nil {
+		args = append(args, filter.LastReportCount, *filter.LastTargetID)
+		query += fmt.Sprintf(" WHERE (g.report_count, g.target_id) < ($%v, $%v)", len(args)-1, len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY g.report_count DESC, g.target_id DESC LIMIT %v", utils.Config.PaginationLimit)
+	t, err = rowsToStruct[models.ReportedTarget](query, args...)
 	return
 }
 
@@ -41,7 +212,28 @@ func FindReport(reportID string) (r models.ReportWithUser, err error) {
 	return
 }
 
-func SetReportIsClosed(reportID string, newState bool) (bool, error) {
-	cmd, err := db.Exec(context.Background(), setIsClosedSql, newState, reportID)
+func UpdateReportStatus(reportID string, status models.ReportStatus, handledBy string, note *string, action *models.ReportAction) (bool, error) {
+	cmd, err := db.Exec(context.Background(), updateReportStatusSql, reportID, status, handledBy, note, action)
 	return cmd.RowsAffected() == 1, err
 }
+
+// Same as UpdateReportStatus but only if nobody has closed the report yet
+func UpdateOpenReportStatus(tx pgx.Tx, reportID string, status models.ReportStatus, handledBy string, note *string, action *models.ReportAction) (bool, error) {
+	query := updateReportStatusSql + " AND status IN ('open', 'in_review')"
+	cmd, err := tx.Exec(context.Background(), query, reportID, status, handledBy, note, action)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Calculates weighted number of distinct users that currently report the resource.
+// Reporters whose accounts are younger than fullWeightAge count proportionally less.
+func FetchReportScore(targetType models.ReportTarget, targetID string, fullWeightAge time.Duration) (score float64, err error) {
+	seconds := max(fullWeightAge.Seconds(), 1)
+	err = db.QueryRow(context.Background(), fetchReportScoreSql, targetType, targetID, seconds).Scan(&score)
+	return
+}
+
+// Dismisses all reports of the resource that are still waiting for a decision
+func DismissOpenReports(tx pgx.Tx, targetType models.ReportTarget, targetID string, handledBy string, note string) error {
+	_, err := tx.Exec(context.Background(), dismissOpenReportsSql, targetType, targetID, handledBy, note)
+	return err
+}
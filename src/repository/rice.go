@@ -21,6 +21,17 @@ SELECT EXISTS (
 )
 `
 
+// Hides content of shadow banned users from everyone except the users themselves.
+// viewerArg is a placeholder of the caller's ID or an empty string if the caller is anonymous.
+func notShadowBanned(column string, viewerArg string) string {
+	filter := column + " NOT IN (SELECT user_id FROM shadow_banned_users)"
+	if viewerArg == "" {
+		return filter
+	}
+
+	return fmt.Sprintf("(%v OR %v = %v)", filter, column, viewerArg)
+}
+
 // FIXME: score has to be fetched for all responses even when not needed because PartialRice requires it
 func buildFetchRicesSql(sortBy string, subsequent bool, withUser bool, reverse bool) string {
 	argCount := 1
@@ -41,7 +52,9 @@ func buildFetchRicesSql(sortBy string, subsequent bool, withUser bool, reverse b
 	`
 
 	userSelect := "false AS is_starred"
+	viewerArg := ""
 	if withUser {
+		viewerArg = fmt.Sprintf("$%v", argCount)
 		userSelect = fmt.Sprintf(`
 				EXISTS (
 					SELECT 1
@@ -56,7 +69,7 @@ func buildFetchRicesSql(sortBy string, subsequent bool, withUser bool, reverse b
 			FROM rices r
 			JOIN users u ON u.id = r.author_id
 			LEFT JOIN rice_stars s ON s.rice_id = r.id
-			LEFT JOIN rice_comments c ON c.rice_id = r.id
+			LEFT JOIN rice_comments c ON c.rice_id = r.id AND c.is_hidden = false AND c.hidden_by_rice_author = false AND c.deleted_at IS NULL AND ` + notShadowBanned("c.author_id", viewerArg) + `
 			JOIN rice_dotfiles df ON df.rice_id = r.id
 			JOIN LATERAL (
 				SELECT p.file_path
@@ -65,7 +78,7 @@ func buildFetchRicesSql(sortBy string, subsequent bool, withUser bool, reverse b
 				ORDER BY p.created_at
 				LIMIT 1
 			) p ON TRUE
-			WHERE r.state != 'waiting'
+			WHERE r.state = 'accepted' AND ` + notShadowBanned("r.author_id", viewerArg) + `
 			GROUP BY
 				r.id, r.slug, r.title, r.created_at,
 				df.download_count, u.display_name,
@@ -136,7 +149,8 @@ func buildFindRiceSql(findBy FindRiceBy) string {
 		to_jsonb(df) AS dotfiles,
 		jsonb_agg(to_jsonb(p) ORDER BY p.id) AS previews,
 		count(DISTINCT s.user_id) AS star_count,
-		coalesce(bool_or(s.user_id = $1), false) AS is_starred
+		coalesce(bool_or(s.user_id = $1), false) AS is_starred,
+		bool_or(NOT ` + notShadowBanned("base.author_id", "") + `) AS author_shadow_banned
 	FROM base
 	JOIN users_with_ban_status u ON u.id = base.author_id
 	JOIN rice_dotfiles df ON df.rice_id = base.id
@@ -175,10 +189,29 @@ VALUES ($1, $2, $3, $4, $5)
 RETURNING *
 `
 const insertPreviewSql = `
-INSERT INTO rice_previews (rice_id, file_path)
-VALUES ($1, $2)
+INSERT INTO rice_previews (rice_id, file_path, phash)
+VALUES ($1, $2, $3)
 RETURNING *
 `
+
+// flags all previews of other authors whose perceptual hash is close enough to the new one
+const flagDuplicatePreviewsSql = `
+WITH new_preview AS (
+	SELECT p.id, p.phash, r.author_id
+	FROM rice_previews p
+	JOIN rices r ON r.id = p.rice_id
+	WHERE p.id = $1
+)
+INSERT INTO rice_preview_duplicates (preview_id, original_preview_id, distance)
+SELECT np.id, p.id, bit_count((p.phash # np.phash)::bit(64))
+FROM new_preview np
+JOIN rice_previews p ON p.phash IS NOT NULL
+JOIN rices r ON r.id = p.rice_id
+WHERE
+	r.author_id != np.author_id
+	AND bit_count((p.phash # np.phash)::bit(64)) <= $2
+ON CONFLICT DO NOTHING
+`
 const insertDotfilesSql = `
 INSERT INTO rice_dotfiles (rice_id, file_path, file_size)
 VALUES ($1, $2, $3)
@@ -201,6 +234,19 @@ FROM rices r
 WHERE r.id = $1 AND r.id = df.rice_id
 RETURNING df.file_path
 `
+const insertStateChangeSql = `
+INSERT INTO rice_state_history (rice_id, changed_by, old_state, new_state, reason)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+const fetchStateHistorySql = `
+SELECT h.id, h.rice_id, h.changed_by, u.username AS changed_by_username, h.old_state, h.new_state, h.reason, h.created_at
+FROM rice_state_history h
+LEFT JOIN users u ON u.id = h.changed_by
+WHERE h.rice_id = $1
+ORDER BY h.created_at DESC
+`
+
 const deletePreviewSql = `
 DELETE FROM rice_previews
 WHERE id = $1 AND rice_id = $2
@@ -222,7 +268,7 @@ type Pagination struct {
 }
 
 func FetchPageCount() (pages float32, err error) {
-	query := "SELECT CEIL(COUNT(*) / $1) FROM rices"
+	query := "SELECT CEIL(COUNT(*) / $1) FROM rices WHERE state = 'accepted' AND " + notShadowBanned("author_id", "")
 	err = db.QueryRow(context.Background(), query, utils.Config.PaginationLimit).Scan(&pages)
 	return
 }
@@ -313,34 +359,6 @@ func FetchMostStarredRices(pag *Pagination, userID *string) (r []models.PartialR
 	return
 }
 
-func FetchWaitingRices() ([]models.PartialRice, error) {
-	const query = `
-	SELECT
-    	r.id, r.title, r.slug, r.created_at, r.state,
-		u.display_name, u.username,
-		p.file_path AS thumbnail,
-		0 AS star_count,
-		0 AS comment_count,
-		0 AS download_count,
-		0 AS score,
-		false AS is_starred
-	FROM rices r
-	JOIN users u ON u.id = r.author_id
-	JOIN LATERAL (
-		SELECT p.file_path
-		FROM rice_previews p
-		WHERE p.rice_id = r.id
-		ORDER BY p.created_at
-		LIMIT 1
-	) p ON TRUE
-	WHERE r.state = 'waiting'
-	GROUP BY r.id, r.slug, r.title, r.created_at, u.display_name, u.username, p.file_path
-	ORDER BY r.created_at DESC
-	`
-
-	return rowsToStruct[models.PartialRice](query)
-}
-
 func FetchRicePreviewCount(riceID string) (int, error) {
 	var count int
 	err := db.QueryRow(
@@ -371,7 +389,7 @@ func FindRiceBySlug(userID *string, slug string, username string) (r models.Rice
 func FetchUserRices(userID string, callerID *string) (r []models.PartialRice, err error) {
 	where := "WHERE u.id = $1"
 	if callerID == nil || userID != *callerID {
-		where += " AND r.state = 'accepted'"
+		where += " AND r.state = 'accepted' AND " + notShadowBanned("r.author_id", "")
 	}
 
 	query := `
@@ -409,25 +427,23 @@ func FetchUserRices(userID string, callerID *string) (r []models.PartialRice, er
 	return
 }
 
-func InsertRice(tx pgx.Tx, authorID string, title string, slug string, description string, autoAccept bool) (rice models.Rice, err error) {
-	state := models.Waiting
-	if autoAccept {
-		state = models.Accepted
-	}
-
+func InsertRice(tx pgx.Tx, authorID string, title string, slug string, description string, state models.RiceState) (rice models.Rice, err error) {
 	rice, err = txRowToStruct[models.Rice](tx, insertRiceSql, authorID, title, slug, description, state)
 
 	return
 }
 
-func InsertRicePreview(riceID string, previewPath string) (p models.RicePreview, err error) {
-	p, err = rowToStruct[models.RicePreview](insertPreviewSql, riceID, previewPath)
+func InsertRicePreviewTx(tx pgx.Tx, riceID uuid.UUID, previewPath string, phash uint64) (p models.RicePreview, err error) {
+	p, err = txRowToStruct[models.RicePreview](tx, insertPreviewSql, riceID, previewPath, int64(phash))
 	return
 }
 
-func InsertRicePreviewTx(tx pgx.Tx, riceID uuid.UUID, previewPath string) error {
-	_, err := tx.Exec(context.Background(), insertPreviewSql, riceID, previewPath)
-	return err
+// Flags previously uploaded previews (by other authors) that are similar to the provided one.
+// Returns how many duplicates were found.
+func FlagDuplicatePreviews(tx pgx.Tx, previewID uuid.UUID) (int64, error) {
+	maxDistance := utils.Config.Moderation.DuplicatePreviewDistance
+	cmd, err := tx.Exec(context.Background(), flagDuplicatePreviewsSql, previewID, maxDistance)
+	return cmd.RowsAffected(), err
 }
 
 func InsertRiceDotfiles(tx pgx.Tx, riceID uuid.UUID, dotfilesPath string, dotfilesSize int64) (df models.RiceDotfiles, err error) {
@@ -469,12 +485,34 @@ func UpdateRiceDotfiles(riceID string, filePath string, fileSize int64) (df mode
 	return
 }
 
-func UpdateRiceState(riceID string, newState models.RiceState) error {
-	query := "UPDATE rices SET state = $1 WHERE id = $2"
-	_, err := db.Exec(context.Background(), query, newState, riceID)
+// Changes the state only if it's still oldState. Returns false if someone else changed it in the meantime.
+func UpdateRiceState(tx pgx.Tx, riceID string, oldState models.RiceState, newState models.RiceState, reason *string) (bool, error) {
+	query := "UPDATE rices SET state = $1, state_reason = $2 WHERE id = $3 AND state = $4"
+	cmd, err := tx.Exec(context.Background(), query, newState, reason, riceID, oldState)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Hides the rice only if it's currently public so it doesn't override moderator decisions
+func HideAcceptedRice(tx pgx.Tx, riceID string, reason string) (bool, error) {
+	cmd, err := tx.Exec(
+		context.Background(),
+		"UPDATE rices SET state = 'hidden', state_reason = $2 WHERE id = $1 AND state = 'accepted'",
+		riceID, reason,
+	)
+	return cmd.RowsAffected() == 1, err
+}
+
+// changedBy is nil when the change was made automatically by the system
+func InsertRiceStateChange(tx pgx.Tx, riceID string, changedBy *string, oldState models.RiceState, newState models.RiceState, reason *string) error {
+	_, err := tx.Exec(context.Background(), insertStateChangeSql, riceID, changedBy, oldState, newState, reason)
 	return err
 }
 
+func FetchRiceStateHistory(riceID string) (h []models.RiceStateChange, err error) {
+	h, err = rowsToStruct[models.RiceStateChange](fetchStateHistorySql, riceID)
+	return
+}
+
 func IncrementDotfilesDownloads(riceID string) (string, error) {
 	var filePath string
 	err := db.QueryRow(context.Background(), incrementDownloadsSql, riceID).Scan(&filePath)
@@ -486,6 +524,21 @@ func DeleteRicePreview(riceID string, previewID string) (bool, error) {
 	return cmd.RowsAffected() == 1, err
 }
 
+// Deletes preview no matter which rice it belongs to and returns its file path
+func DeleteRicePreviewById(tx pgx.Tx, previewID string) (filePath string, err error) {
+	err = tx.QueryRow(
+		context.Background(),
+		"DELETE FROM rice_previews WHERE id = $1 RETURNING file_path",
+		previewID,
+	).Scan(&filePath)
+	return
+}
+
+func FetchRiceStarCount(riceID string) (count int, err error) {
+	err = db.QueryRow(context.Background(), "SELECT COUNT(*) FROM rice_stars WHERE rice_id = $1", riceID).Scan(&count)
+	return
+}
+
 // star deletion is the only query where i dont see the need to check if any row was affected
 func DeleteRiceStar(riceID string, userID string) error {
 	_, err := db.Exec(
@@ -504,3 +557,9 @@ func DeleteRice(riceID string) (bool, error) {
 	)
 	return cmd.RowsAffected() == 1, err
 }
+
+// Used to notify rice authors about activity on their rices
+func FindRiceAuthorID(riceID string) (authorID string, err error) {
+	err = db.QueryRow(context.Background(), "SELECT author_id::text FROM rices WHERE id = $1", riceID).Scan(&authorID)
+	return
+}
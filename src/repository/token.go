@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ricehub/src/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Only the newest token of each purpose is valid, older unused ones are removed
+const insertUserTokenSql = `
+WITH old AS (
+	DELETE FROM user_tokens
+	WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+)
+INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+// Marking the token as used in the same query makes sure it can't be used twice
+const consumeUserTokenSql = `
+UPDATE user_tokens SET used_at = now()
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+RETURNING *
+`
+
+const findUserByVerifiedEmailSql = `
+SELECT u.*
+FROM users_with_ban_status u
+JOIN user_emails e ON e.user_id = u.id
+WHERE e.email = $1 AND e.verified_at IS NOT NULL
+`
+
+const revokeSessionsSql = `
+INSERT INTO session_revocations (user_id, revoked_at)
+VALUES ($1, now())
+ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at
+RETURNING revoked_at
+`
+
+func InsertUserToken(userID string, purpose models.UserTokenPurpose, tokenHash []byte, email string, expiresAt time.Time) error {
+	_, err := db.Exec(context.Background(), insertUserTokenSql, userID, purpose, tokenHash, email, expiresAt)
+	return err
+}
+
+// Returns pgx.ErrNoRows if the token doesn't exist, expired or was already used
+func ConsumeUserToken(tx pgx.Tx, tokenHash []byte, purpose models.UserTokenPurpose) (t models.UserToken, err error) {
+	t, err = txRowToStruct[models.UserToken](tx, consumeUserTokenSql, tokenHash, purpose)
+	return
+}
+
+func DeleteUnusedUserTokens(tx pgx.Tx, userID string, purpose models.UserTokenPurpose) error {
+	_, err := tx.Exec(
+		context.Background(),
+		"DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	)
+	return err
+}
+
+// Used to send password resets, unverified addresses may not belong to the user
+func FindUserByVerifiedEmail(email string) (u models.User, err error) {
+	u, err = rowToStruct[models.User](findUserByVerifiedEmailSql, email)
+	return
+}
+
+// Verification only applies if the user still has the address the token was sent to.
+// Proven owner takes the address over from other users that haven't verified it.
+// Fails with unique violation if another user has already verified the address.
+func MarkEmailVerified(tx pgx.Tx, userID string, email string) (bool, error) {
+	_, err := tx.Exec(
+		context.Background(),
+		"DELETE FROM user_emails WHERE email = $2 AND user_id != $1 AND verified_at IS NULL",
+		userID, email,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	cmd, err := tx.Exec(
+		context.Background(),
+		"UPDATE user_emails SET verified_at = now() WHERE user_id = $1 AND email = $2 AND verified_at IS NULL",
+		userID, email,
+	)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Invalidates all access and refresh tokens issued so far
+func RevokeSessions(tx pgx.Tx, userID string) (revokedAt time.Time, err error) {
+	err = tx.QueryRow(context.Background(), revokeSessionsSql, userID).Scan(&revokedAt)
+	return
+}
+
+// Returns zero time if user's sessions were never revoked
+func FindSessionsRevokedAt(userID string) (revokedAt time.Time, err error) {
+	err = db.QueryRow(
+		context.Background(),
+		"SELECT revoked_at FROM session_revocations WHERE user_id = $1",
+		userID,
+	).Scan(&revokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return
+}
@@ -32,18 +32,25 @@ func DoesUserExistsByUsername(username string) (exists bool, err error) {
 	return
 }
 
-func InsertUser(username string, displayName string, password string) error {
+// email is optional
+func InsertUser(username string, displayName string, password string, ip string, email *string) (userID string, err error) {
 	query := `
-	INSERT INTO users (username, display_name, password)
-	VALUES ($1, $2, $3)
+	WITH u AS (
+		INSERT INTO users (username, display_name, password)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	), ip AS (
+		INSERT INTO user_ips (user_id, registration_ip)
+		SELECT id, $4 FROM u
+	), e AS (
+		INSERT INTO user_emails (user_id, email)
+		SELECT id, $5 FROM u WHERE $5::text IS NOT NULL
+	)
+	SELECT id::text FROM u
 	`
 
-	_, err := db.Exec(context.Background(), query, username, displayName, password)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	err = db.QueryRow(context.Background(), query, username, displayName, password, ip, email).Scan(&userID)
+	return
 }
 
 func FetchRecentUsers(limit int) (users []models.User, err error) {
@@ -74,7 +81,7 @@ func FetchBannedUsers() ([]models.UserWithBan, error) {
 		to_jsonb(u) AS "user",
 		to_jsonb(b) AS "ban"
 	FROM users_with_ban_status u
-	JOIN user_bans b ON b.user_id = u.id
+	JOIN user_bans b ON b.user_id = u.id AND b.scope = 'all'
 	WHERE
 		u.is_banned = true
 	ORDER BY u.id, b.banned_at DESC
@@ -117,6 +124,11 @@ func UpdateUserPassword(userID string, password string) error {
 	return err
 }
 
+func UpdateUserPasswordTx(tx pgx.Tx, userID string, password string) error {
+	_, err := tx.Exec(context.Background(), "UPDATE users SET password = $1 WHERE id = $2", password, userID)
+	return err
+}
+
 func UpdateUserAvatarPath(userID string, avatarPath *string) error {
 	query := "UPDATE users SET avatar_path = $1 WHERE id = $2"
 	_, err := db.Exec(context.Background(), query, avatarPath, userID)
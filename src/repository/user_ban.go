@@ -2,13 +2,16 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"ricehub/src/models"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
-func IsUserBanned(userID string) (state models.UserState, err error) {
+// Checks whether user exists and has an active ban with provided scope
+func IsUserBanned(userID string, scope models.BanScope) (state models.UserState, err error) {
 	const query = `
 	SELECT
 		EXISTS(
@@ -19,22 +22,29 @@ func IsUserBanned(userID string) (state models.UserState, err error) {
 			FROM user_bans
 			WHERE
 				user_id = $1 AND
+				scope = $2 AND
 				(expires_at > NOW() OR expires_at IS NULL) AND
 				is_revoked = false
 		) AS user_banned
 	`
 
-	return rowToStruct[models.UserState](query, userID)
+	return rowToStruct[models.UserState](query, userID, scope)
 }
 
-func InsertBan(userID string, adminID string, reason string, expiresAt *time.Time) (ban models.UserBan, err error) {
+func InsertBan(userID string, adminID string, scope models.BanScope, reason string, expiresAt *time.Time) (ban models.UserBan, err error) {
 	const query = `
-	INSERT INTO user_bans (user_id, admin_id, reason, expires_at)
-	VALUES ($1, $2, $3, $4)
-	RETURNING *
+	WITH ban AS (
+		INSERT INTO user_bans (user_id, admin_id, scope, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *
+	), change AS (
+		INSERT INTO user_ban_changes (ban_id, admin_id, action, new_reason, new_expires_at)
+		SELECT id, admin_id, 'created', reason, expires_at FROM ban
+	)
+	SELECT * FROM ban
 	`
 
-	return rowToStruct[models.UserBan](query, userID, adminID, reason, expiresAt)
+	return rowToStruct[models.UserBan](query, userID, adminID, scope, reason, expiresAt)
 }
 
 func FetchUserBan(userID uuid.UUID) (ban models.UserBan, err error) {
@@ -43,6 +53,7 @@ func FetchUserBan(userID uuid.UUID) (ban models.UserBan, err error) {
 	FROM user_bans
 	WHERE 
 		user_id = $1 AND 
+		scope = 'all' AND
 		(expires_at > NOW() OR expires_at IS NULL) AND
 		is_revoked = false
 	`
@@ -50,14 +61,164 @@ func FetchUserBan(userID uuid.UUID) (ban models.UserBan, err error) {
 	return rowToStruct[models.UserBan](query, userID)
 }
 
-// revoke is an irreversible action therefore no need for generalized 'set is_revoked' function as it can only be updated to one state
-func RevokeBan(userID string) error {
+// Fetches active restriction of the user, the one lasting the longest if there are more
+func FetchUserRestriction(userID string, scope models.BanScope) (ban models.UserBan, err error) {
 	const query = `
-	UPDATE user_bans
-	SET is_revoked = true
+	SELECT *
+	FROM user_bans
+	WHERE
+		user_id = $1 AND
+		scope = $2 AND
+		(expires_at > NOW() OR expires_at IS NULL) AND
+		is_revoked = false
+	ORDER BY expires_at DESC NULLS FIRST
+	LIMIT 1
+	`
+
+	return rowToStruct[models.UserBan](query, userID, scope)
+}
+
+// Fetches every ban the user ever received, latest first
+func FetchUserBans(userID string) (bans []models.UserBan, err error) {
+	const query = `
+	SELECT *
+	FROM user_bans
 	WHERE user_id = $1
+	ORDER BY banned_at DESC
+	`
+
+	return rowsToStruct[models.UserBan](query, userID)
+}
+
+// Fetches changes of all user's bans in chronological order
+func FetchUserBanChanges(userID string) (changes []models.UserBanChange, err error) {
+	const query = `
+	SELECT c.*, u.username AS admin_username
+	FROM user_ban_changes c
+	JOIN user_bans b ON b.id = c.ban_id
+	LEFT JOIN users u ON u.id = c.admin_id
+	WHERE b.user_id = $1
+	ORDER BY c.created_at
+	`
+
+	return rowsToStruct[models.UserBanChange](query, userID)
+}
+
+func FindUserBan(userID string, banID string) (ban models.UserBan, err error) {
+	const query = `
+	SELECT *
+	FROM user_bans
+	WHERE id = $1 AND user_id = $2
+	`
+
+	return rowToStruct[models.UserBan](query, banID, userID)
+}
+
+// Changes reason and/or expiration of an active ban and records the previous values.
+// Expiration is only changed if changeExpiration is true so the ban can be made permanent with nil.
+// Returns pgx.ErrNoRows if the ban isn't active anymore.
+func UpdateBan(banID string, adminID string, reason *string, changeExpiration bool, expiresAt *time.Time) (ban models.UserBan, err error) {
+	const query = `
+	WITH old AS (
+		SELECT id, reason, expires_at
+		FROM user_bans
+		WHERE
+			id = $1 AND
+			(expires_at > NOW() OR expires_at IS NULL) AND
+			is_revoked = false
+		FOR UPDATE
+	), updated AS (
+		UPDATE user_bans b
+		SET
+			reason = coalesce($3, b.reason),
+			expires_at = CASE WHEN $4::bool THEN $5::timestamptz ELSE b.expires_at END
+		FROM old
+		WHERE b.id = old.id
+		RETURNING b.*
+	), change AS (
+		INSERT INTO user_ban_changes (ban_id, admin_id, action, old_reason, new_reason, old_expires_at, new_expires_at)
+		SELECT u.id, $2, 'updated', o.reason, u.reason, o.expires_at, u.expires_at
+		FROM updated u
+		JOIN old o ON o.id = u.id
+	)
+	SELECT * FROM updated
 	`
 
-	_, err := db.Exec(context.Background(), query, userID)
+	return rowToStruct[models.UserBan](query, banID, adminID, reason, changeExpiration, expiresAt)
+}
+
+// revoke is an irreversible action therefore no need for generalized 'set is_revoked' function as it can only be updated to one state
+const revokeBansSql = `
+WITH revoked AS (
+	UPDATE user_bans
+	SET is_revoked = true, revoked_by = $2
+	WHERE
+		%v AND
+		(expires_at > NOW() OR expires_at IS NULL) AND
+		is_revoked = false
+	RETURNING id
+)
+INSERT INTO user_ban_changes (ban_id, admin_id, action)
+SELECT id, $2, 'revoked' FROM revoked
+`
+
+// Revokes every active full ban of the user, restrictions stay untouched
+func RevokeBan(userID string, adminID string) error {
+	query := fmt.Sprintf(revokeBansSql, "user_id = $1 AND scope = 'all'")
+	_, err := db.Exec(context.Background(), query, userID, adminID)
+	return err
+}
+
+func RevokeBanTx(tx pgx.Tx, userID string, adminID string) error {
+	query := fmt.Sprintf(revokeBansSql, "user_id = $1 AND scope = 'all'")
+	_, err := tx.Exec(context.Background(), query, userID, adminID)
 	return err
 }
+
+// Revokes one specific ban, returns false if it wasn't active
+func RevokeBanById(banID string, adminID string) (bool, error) {
+	query := fmt.Sprintf(revokeBansSql, "id = $1")
+	cmd, err := db.Exec(context.Background(), query, banID, adminID)
+	return cmd.RowsAffected() == 1, err
+}
+
+// Attaches appeal to the ban. Returns pgx.ErrNoRows if the ban has already been appealed.
+func InsertBanAppeal(banID uuid.UUID, message string) (ban models.UserBan, err error) {
+	const query = `
+	UPDATE user_bans
+	SET appeal_message = $2, appeal_status = 'pending', appealed_at = NOW()
+	WHERE id = $1 AND appeal_status IS NULL
+	RETURNING *
+	`
+
+	return rowToStruct[models.UserBan](query, banID, message)
+}
+
+// Fetches appeals with provided status, oldest appeals first
+func FetchBanAppeals(status models.AppealStatus) (appeals []models.BanAppeal, err error) {
+	const query = `
+	SELECT b.*, u.username, u.display_name
+	FROM user_bans b
+	JOIN users u ON u.id = b.user_id
+	WHERE b.appeal_status = $1
+	ORDER BY b.appealed_at
+	`
+
+	return rowsToStruct[models.BanAppeal](query, status)
+}
+
+// Saves moderator's decision. Returns pgx.ErrNoRows if there's no pending appeal for the ban.
+func ReviewBanAppeal(tx pgx.Tx, banID string, status models.AppealStatus, reviewerID string, response *string) (ban models.UserBan, err error) {
+	const query = `
+	UPDATE user_bans
+	SET
+		appeal_status = $2,
+		appeal_reviewed_by = $3,
+		appeal_response = $4,
+		appeal_reviewed_at = NOW()
+	WHERE id = $1 AND appeal_status = 'pending'
+	RETURNING *
+	`
+
+	return txRowToStruct[models.UserBan](tx, query, banID, status, reviewerID, response)
+}
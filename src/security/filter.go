@@ -0,0 +1,231 @@
+package security
+
+import (
+	"regexp"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/utils"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// replaces masked characters, asterisks and similar would turn masked words into markdown emphasis or rules
+const maskRune = '█'
+
+type compiledFilterRule struct {
+	models.FilterRule
+	re *regexp.Regexp
+}
+
+// rules are compiled once and swapped as a whole when they change
+var contentFilter struct {
+	sync.RWMutex
+	rules []compiledFilterRule
+}
+
+// characters commonly used in leetspeak and the letters they stand for
+var leetReplacements = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+}
+
+// Lowercases the text, strips diacritics and replaces leetspeak characters.
+//
+// Every rune is replaced with exactly one rune so positions of matches
+// in the normalized text are the same as in the original one.
+func normalizeText(text string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		if replacement, ok := leetReplacements[r]; ok {
+			runes[i] = replacement
+			continue
+		}
+
+		// compatibility decomposition splits 'é' into 'e' + accent and turns fullwidth letters into ascii ones
+		if decomposed := []rune(norm.NFKD.String(string(r))); len(decomposed) > 0 && unicode.IsLetter(decomposed[0]) {
+			r = decomposed[0]
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+
+	return string(runes)
+}
+
+// Compiles the rule into a case-insensitive regex. Word rules only match whole words.
+func CompileFilterRule(rule models.FilterRule) (*regexp.Regexp, error) {
+	if rule.Kind == models.RegexRule {
+		return regexp.Compile("(?i)" + rule.Pattern)
+	}
+
+	word := rule.Pattern
+	if rule.Normalize {
+		word = normalizeText(word)
+	}
+
+	return regexp.Compile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
+}
+
+// Fetches all rules from the database and replaces currently used ones.
+// Rules that fail to compile are skipped so one broken rule doesn't disable the whole filter.
+func ReloadContentFilter() error {
+	rules, err := repository.FetchFilterRules()
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]compiledFilterRule, 0, len(rules))
+	for _, rule := range rules {
+		re, err := CompileFilterRule(rule)
+		if err != nil {
+			zap.L().Warn("Skipping invalid content filter rule", zap.String("ruleId", rule.ID.String()), zap.Error(err))
+			continue
+		}
+
+		compiled = append(compiled, compiledFilterRule{rule, re})
+	}
+
+	contentFilter.Lock()
+	contentFilter.rules = compiled
+	contentFilter.Unlock()
+
+	zap.L().Info("Content filter rules loaded", zap.Int("count", len(compiled)))
+	return nil
+}
+
+// Moves words from the old [blacklist] config section to the content filter so upgraded
+// deployments don't lose their word filter. Has to run before the rules are loaded.
+func ImportBlacklistedWords() error {
+	words := utils.Config.Blacklist.Words
+	if len(words) == 0 {
+		return nil
+	}
+
+	imported, err := repository.ImportBlacklistedWords(words)
+	if err != nil {
+		return err
+	}
+
+	if imported > 0 {
+		zap.L().Info("Imported blacklisted words as content filter rules", zap.Int64("count", imported))
+	}
+	zap.L().Warn("Blacklisted words are now managed as content filter rules, remove 'words' from the [blacklist] config section")
+	return nil
+}
+
+// Reloads the rules every time any API instance changes them
+func WatchContentFilter() {
+	utils.SubscribeFilterRulesChanges(func() {
+		if err := ReloadContentFilter(); err != nil {
+			zap.L().Error("Failed to reload content filter rules", zap.Error(err))
+		}
+	})
+}
+
+// Asks every API instance to reload the rules, falls back to reloading only this one
+func NotifyContentFilterChange() {
+	err := utils.PublishFilterRulesChange()
+	if err == nil {
+		return
+	}
+
+	zap.L().Warn("Failed to publish content filter change", zap.Error(err))
+	if err := ReloadContentFilter(); err != nil {
+		zap.L().Error("Failed to reload content filter rules", zap.Error(err))
+	}
+}
+
+type FilterResult struct {
+	// text with masked parts replaced
+	Text     string
+	Rejected bool
+	Flagged  bool
+	// patterns of all rules that matched
+	Matched []string
+}
+
+// Runs the text through every content filter rule
+func FilterContent(text string) FilterResult {
+	contentFilter.RLock()
+	defer contentFilter.RUnlock()
+
+	result := FilterResult{Text: text}
+	normalized := normalizeText(text)
+	masked := []rune(text)
+
+	for _, rule := range contentFilter.rules {
+		subject := text
+		if rule.Normalize {
+			subject = normalized
+		}
+
+		matches := rule.re.FindAllStringIndex(subject, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		result.Matched = append(result.Matched, rule.Pattern)
+
+		switch rule.Action {
+		case models.RejectContent:
+			result.Rejected = true
+		case models.FlagContent:
+			result.Flagged = true
+		case models.MaskContent:
+			for _, m := range matches {
+				start := len([]rune(subject[:m[0]]))
+				end := start + len([]rune(subject[m[0]:m[1]]))
+				for i := start; i < end && i < len(masked); i++ {
+					if !unicode.IsSpace(masked[i]) {
+						masked[i] = maskRune
+					}
+				}
+			}
+		}
+	}
+
+	result.Text = string(masked)
+	return result
+}
+
+// Names can't be masked or reviewed later so any matching rule makes them invalid
+func containsFilteredContent(text string) bool {
+	return len(FilterContent(text).Matched) > 0
+}
+
+func IsUsernameBlacklisted(username string) bool {
+	bl := utils.Config.Blacklist
+
+	// check for exact matches
+	exact := append(bl.DisplayNames, bl.Usernames...)
+	for _, word := range exact {
+		if strings.EqualFold(word, username) {
+			return true
+		}
+	}
+
+	return containsFilteredContent(username)
+}
+
+func IsDisplayNameBlacklisted(displayName string) bool {
+	// check for whole words and not substrings
+	for _, name := range utils.Config.Blacklist.DisplayNames {
+		re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+		if re.MatchString(displayName) {
+			return true
+		}
+	}
+
+	return containsFilteredContent(displayName)
+}
@@ -102,6 +102,7 @@ func NewAccessToken(userID uuid.UUID, isAdmin bool) (token string, err error) {
 		IsAdmin: isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 	}
@@ -114,6 +115,7 @@ func NewRefreshToken(userID uuid.UUID) (token string, err error) {
 	claims := RefreshToken{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 	}
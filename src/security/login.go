@@ -0,0 +1,148 @@
+package security
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/models"
+	"ricehub/src/repository"
+	"ricehub/src/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"go.uber.org/zap"
+)
+
+// hash of a random password, computed once when it's first needed
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := argon2id.CreateHash("not a real password, only used to keep timing even", argon2id.DefaultParams)
+	if err != nil {
+		zap.L().Fatal("Failed to create dummy password hash", zap.Error(err))
+	}
+	return hash
+})
+
+// Burns the same amount of time as checking a real password,
+// so response time doesn't reveal whether the username exists
+func CompareDummyPassword(password string) {
+	_, _ = argon2id.ComparePasswordAndHash(password, dummyHash())
+}
+
+// Makes sure the login section of the config is usable. Missing values would e.g. lock
+// the login after every single failure or block it forever.
+func ValidateLoginConfig() {
+	cfg := utils.Config.Login
+	logger := zap.L()
+
+	durations := map[string]time.Duration{
+		"failure_window":   cfg.FailureWindow,
+		"base_delay":       cfg.BaseDelay,
+		"max_delay":        cfg.MaxDelay,
+		"lockout_duration": cfg.LockoutDuration,
+	}
+	for name, value := range durations {
+		if value <= 0 {
+			logger.Fatal("Login setting has to be a positive duration", zap.String("setting", name), zap.Duration("value", value))
+		}
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		logger.Fatal("Login max_delay can't be shorter than base_delay", zap.Duration("baseDelay", cfg.BaseDelay), zap.Duration("maxDelay", cfg.MaxDelay))
+	}
+
+	if cfg.DelayAfter < 0 {
+		logger.Fatal("Login delay_after can't be negative", zap.Int("delayAfter", cfg.DelayAfter))
+	}
+	// delays only make sense before the username gets locked
+	if cfg.UsernameLockoutThreshold <= cfg.DelayAfter {
+		logger.Fatal("Login username_lockout_threshold has to be greater than delay_after",
+			zap.Int("delayAfter", cfg.DelayAfter),
+			zap.Int("usernameLockoutThreshold", cfg.UsernameLockoutThreshold),
+		)
+	}
+	if cfg.IPLockoutThreshold <= 0 {
+		logger.Fatal("Login ip_lockout_threshold has to be positive", zap.Int("ipLockoutThreshold", cfg.IPLockoutThreshold))
+	}
+}
+
+// usernames are case insensitive
+func usernameSubject(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// Checks whether the username or the IP address is temporarily blocked after failed attempts.
+// Returns how long the caller has to wait.
+func CheckLoginAllowed(username string, ip string) (time.Duration, error) {
+	remaining, err := utils.LoginBlockedFor(usernameSubject(username), ipSubject(ip))
+	if err != nil {
+		// failing closed would lock everyone out whenever redis has a hiccup
+		zap.L().Error("Failed to check login block", zap.Error(err))
+		return 0, nil
+	}
+	if remaining <= 0 {
+		return 0, nil
+	}
+
+	seconds := int(math.Ceil(remaining.Seconds()))
+	return remaining, errs.UserError(fmt.Sprintf("Too many failed login attempts. Try again in %v seconds.", seconds), http.StatusTooManyRequests)
+}
+
+// Counts the failure towards both the username and the IP address. Failures over the delay
+// threshold block the next attempt for exponentially longer time and too many of them lock the login.
+func RecordLoginFailure(username string, ip string) {
+	cfg := utils.Config.Login
+
+	userFailures, err := utils.IncrementLoginFailures(usernameSubject(username), cfg.FailureWindow)
+	if err != nil {
+		zap.L().Error("Failed to record failed login", zap.Error(err))
+	} else if userFailures >= int64(cfg.UsernameLockoutThreshold) {
+		lockLogin(models.UsernameLockout, usernameSubject(username), &username, ip, userFailures)
+	} else if userFailures > int64(cfg.DelayAfter) {
+		exponent := float64(userFailures - int64(cfg.DelayAfter) - 1)
+		delay := min(time.Duration(float64(cfg.BaseDelay)*math.Pow(2, exponent)), cfg.MaxDelay)
+		if err := utils.BlockLogin(usernameSubject(username), delay); err != nil {
+			zap.L().Error("Failed to delay next login attempt", zap.Error(err))
+		}
+	}
+
+	// the same address trying many usernames is most likely credential stuffing
+	ipFailures, err := utils.IncrementLoginFailures(ipSubject(ip), cfg.FailureWindow)
+	if err != nil {
+		zap.L().Error("Failed to record failed login", zap.Error(err))
+	} else if ipFailures >= int64(cfg.IPLockoutThreshold) {
+		lockLogin(models.IPLockout, ipSubject(ip), nil, ip, ipFailures)
+	}
+}
+
+// Locks logins of the subject and writes an audit record. The failure counter starts over
+// so the next lockout needs as many failures as the first one.
+func lockLogin(scope models.LoginLockoutScope, subject string, username *string, ip string, failures int64) {
+	duration := utils.Config.Login.LockoutDuration
+	logger := zap.L().With(zap.String("scope", string(scope)), zap.String("ip", ip), zap.Int64("failures", failures))
+
+	if err := utils.BlockLogin(subject, duration); err != nil {
+		logger.Error("Failed to lock login", zap.Error(err))
+		return
+	}
+	if err := utils.ResetLoginFailures(subject); err != nil {
+		logger.Error("Failed to reset failed login counter", zap.Error(err))
+	}
+
+	logger.Warn("Login locked after too many failed attempts", zap.Duration("duration", duration))
+	if err := repository.InsertLoginLockout(scope, username, ip, failures, duration); err != nil {
+		logger.Error("Failed to save login lockout", zap.Error(err))
+	}
+}
+
+// Successful login forgets previous failures of the username, IP address counter is kept
+func ResetLoginFailures(username string) {
+	if err := utils.ResetLoginFailures(usernameSubject(username)); err != nil {
+		zap.L().Error("Failed to reset failed login counter", zap.Error(err))
+	}
+}
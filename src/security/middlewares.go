@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"ricehub/src/errs"
+	"ricehub/src/repository"
 	"ricehub/src/utils"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
@@ -42,6 +44,9 @@ func AuthMiddleware(c *gin.Context) {
 	tokenStr = strings.TrimSpace(tokenStr)
 
 	token, err := ValidateToken(tokenStr)
+	if err == nil {
+		err = VerifySession(token.Subject, token.IssuedAt)
+	}
 	if err != nil {
 		// reading the request so Firefox doesn't throw NS_ERROR_NET_RESET
 		_, _ = c.GetRawData()
@@ -55,6 +60,17 @@ func AuthMiddleware(c *gin.Context) {
 	c.Next()
 }
 
+// Browsers can't set headers on EventSource requests so the access token can also be passed as a query parameter
+func StreamAuthMiddleware(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		if tokenStr := c.Query("token"); tokenStr != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+tokenStr)
+		}
+	}
+
+	AuthMiddleware(c)
+}
+
 func AdminMiddleware(c *gin.Context) {
 	token := c.MustGet("token").(*AccessToken)
 
@@ -211,3 +227,40 @@ func MaintenanceMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// middleware that rejects requests from banned networks. With failClosed the request is rejected
+// when the ban can't be checked, which is used for registration and login.
+func IPBanMiddleware(failClosed bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ban, err := repository.FindActiveIPBan(c.ClientIP())
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.Next()
+				return
+			}
+
+			zap.L().Error("Failed to check IP ban", zap.String("client_ip", c.ClientIP()), zap.Error(err))
+			if failClosed {
+				_, _ = c.GetRawData()
+
+				c.Error(errs.InternalError(err))
+				c.Abort()
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		_, _ = c.GetRawData()
+
+		msg := fmt.Sprintf("Your network has been banned permanently. Reason: %v.", ban.Reason)
+		if ban.ExpiresAt != nil {
+			dur := time.Until(*ban.ExpiresAt).Truncate(time.Second)
+			msg = fmt.Sprintf("Your network has been banned for %v. Reason: %v.", dur.String(), ban.Reason)
+		}
+
+		c.Error(errs.UserError(msg, http.StatusForbidden))
+		c.Abort()
+	}
+}
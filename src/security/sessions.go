@@ -0,0 +1,89 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"ricehub/src/errs"
+	"ricehub/src/repository"
+	"ricehub/src/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// revocation time is checked on every authenticated request so it's kept in cache
+const sessionsCacheTTL = 10 * time.Minute
+
+var sessionRevoked = errs.UserError("Your session was revoked! Please log in again.", http.StatusForbidden)
+
+// Generates a random token to be sent to the user and its hash to be stored in the database.
+// Tokens have 256 bits of entropy so a fast hash is enough.
+func NewOneTimeToken() (token string, hash []byte, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	hash = HashOneTimeToken(token)
+	return
+}
+
+func HashOneTimeToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Updates cached revocation time right after user's sessions were revoked
+func CacheSessionsRevocation(userID string, revokedAt time.Time) {
+	if err := utils.SetSessionsRevokedAt(userID, revokedAt, sessionsCacheTTL); err != nil {
+		zap.L().Error("Failed to cache sessions revocation", zap.String("userId", userID), zap.Error(err))
+	}
+}
+
+func sessionsRevokedAt(userID string) (time.Time, error) {
+	revokedAt, found, err := utils.GetSessionsRevokedAt(userID)
+	if err != nil {
+		zap.L().Warn("Failed to read cached sessions revocation", zap.String("userId", userID), zap.Error(err))
+	}
+	if found {
+		return revokedAt, nil
+	}
+
+	revokedAt, err = repository.FindSessionsRevokedAt(userID)
+	if err != nil {
+		return revokedAt, err
+	}
+
+	if err := utils.SetSessionsRevokedAt(userID, revokedAt, sessionsCacheTTL); err != nil {
+		zap.L().Warn("Failed to cache sessions revocation", zap.String("userId", userID), zap.Error(err))
+	}
+	return revokedAt, nil
+}
+
+// Rejects tokens issued before user's sessions were revoked, e.g. by resetting the password
+func VerifySession(userID string, issuedAt *jwt.NumericDate) error {
+	revokedAt, err := sessionsRevokedAt(userID)
+	if err != nil {
+		return errs.InternalError(err)
+	}
+	if revokedAt.IsZero() {
+		return nil
+	}
+
+	// iat has second precision so a token issued right before the revocation could have the same
+	// or even later iat. Revocation time is rounded up and anything issued up to it is rejected,
+	// logging in right after the revocation might have to be repeated a second later.
+	cutoff := revokedAt.Truncate(time.Second)
+	if cutoff.Before(revokedAt) {
+		cutoff = cutoff.Add(time.Second)
+	}
+	if issuedAt == nil || !issuedAt.Time.After(cutoff) {
+		return sessionRevoked
+	}
+
+	return nil
+}
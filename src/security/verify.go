@@ -31,6 +31,45 @@ func VerifyUser(user *models.User) error {
 		msg = fmt.Sprintf("Your account has been restricted for %v. Reason: %v.", dur.String(), ban.Reason)
 	}
 
+	// let the user know whether they can still respond to the ban
+	if ban.AppealStatus == nil {
+		msg += " You can appeal this decision."
+	} else if *ban.AppealStatus == models.AppealPending {
+		msg += " Your appeal is waiting for a review."
+	} else if *ban.AppealStatus == models.AppealDenied && ban.AppealResponse != nil {
+		msg += fmt.Sprintf(" Your appeal has been denied: %v", *ban.AppealResponse)
+	}
+
+	return errs.UserError(msg, http.StatusForbidden)
+}
+
+// names of actions blocked by each restriction used in error messages
+var restrictedActions = map[models.BanScope]string{
+	models.CommentRestriction: "commenting",
+	models.UploadRestriction:  "uploading rices",
+	models.StarRestriction:    "starring rices",
+	models.ReportRestriction:  "reporting",
+	models.ReactRestriction:   "reacting to comments",
+}
+
+// checks whether user (from provided ID) isn't restricted from the action - e.g. muted in comments
+func VerifyRestriction(userID string, scope models.BanScope) error {
+	restriction, err := repository.FetchUserRestriction(userID, scope)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		return errs.InternalError(err)
+	}
+
+	action := restrictedActions[scope]
+	msg := fmt.Sprintf("You have been restricted from %v permanently. Reason: %v.", action, restriction.Reason)
+	if restriction.ExpiresAt != nil {
+		dur := time.Until(*restriction.ExpiresAt).Truncate(time.Second)
+		msg = fmt.Sprintf("You have been restricted from %v for %v. Reason: %v.", action, dur.String(), restriction.Reason)
+	}
+
 	return errs.UserError(msg, http.StatusForbidden)
 }
 
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 )
 
 const testKey = "connTest"
+const filterRulesChannel = "filterRules:changed"
 
 var rdb *redis.Client
 
@@ -79,3 +81,83 @@ func IncrementPathRateLimit(path string, clientID string, expireAfter time.Durat
 	key := fmt.Sprintf("pathRateLimit:%s-%s", path, clientID)
 	return increment(key, expireAfter)
 }
+
+// subject is "user:<username>" or "ip:<address>"
+func IncrementLoginFailures(subject string, window time.Duration) (int64, error) {
+	return increment(fmt.Sprintf("loginFailures:%s", subject), window)
+}
+
+func ResetLoginFailures(subject string) error {
+	return rdb.Del(context.Background(), fmt.Sprintf("loginFailures:%s", subject)).Err()
+}
+
+// Rejects logins of the subject for given duration, longer existing block is kept
+func BlockLogin(subject string, duration time.Duration) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("loginBlock:%s", subject)
+
+	remaining, err := rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if remaining >= duration {
+		return nil
+	}
+
+	return rdb.Set(ctx, key, 1, duration).Err()
+}
+
+// Returns the longest remaining block of given subjects, zero if none of them is blocked
+func LoginBlockedFor(subjects ...string) (time.Duration, error) {
+	ctx := context.Background()
+
+	var longest time.Duration
+	for _, subject := range subjects {
+		remaining, err := rdb.PTTL(ctx, fmt.Sprintf("loginBlock:%s", subject)).Result()
+		if err != nil {
+			return 0, err
+		}
+		// negative values mean the key doesn't exist or has no expiration
+		longest = max(longest, remaining)
+	}
+
+	return longest, nil
+}
+
+// Caches the moment user's sessions were revoked, zero time means they never were.
+func SetSessionsRevokedAt(userID string, revokedAt time.Time, expireAfter time.Duration) error {
+	key := fmt.Sprintf("sessionsRevoked:%s", userID)
+	return rdb.Set(context.Background(), key, revokedAt.UnixNano(), expireAfter).Err()
+}
+
+// found is false if the value isn't cached
+func GetSessionsRevokedAt(userID string) (revokedAt time.Time, found bool, err error) {
+	key := fmt.Sprintf("sessionsRevoked:%s", userID)
+	nanos, err := rdb.Get(context.Background(), key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if nanos == 0 {
+		return time.Time{}, true, nil
+	}
+	return time.Unix(0, nanos), true, nil
+}
+
+// Notifies every API instance that content filter rules have to be reloaded
+func PublishFilterRulesChange() error {
+	return rdb.Publish(context.Background(), filterRulesChannel, "reload").Err()
+}
+
+// Calls onChange whenever content filter rules are changed. It blocks so it should be run in a goroutine.
+func SubscribeFilterRulesChanges(onChange func()) {
+	sub := rdb.Subscribe(context.Background(), filterRulesChannel)
+	defer sub.Close()
+
+	for range sub.Channel() {
+		onChange()
+	}
+}
@@ -21,6 +21,9 @@ type (
 		JWT               jwtConfig
 		Limits            limitsConfig
 		Blacklist         blacklistConfig
+		Moderation        moderationConfig
+		Email             emailConfig
+		Login             loginConfig
 	}
 
 	jwtConfig struct {
@@ -33,9 +36,54 @@ type (
 		UserAvatarSizeLimit int64 `toml:"user_avatar_size_limit"`
 		DotfilesSizeLimit   int64 `toml:"dotfiles_size_limit"`
 		PreviewSizeLimit    int64 `toml:"preview_size_limit"`
+		MaxCommentDepth     int   `toml:"max_comment_depth"`
+	}
+
+	moderationConfig struct {
+		DuplicatePreviewDistance int           `toml:"duplicate_preview_distance"`
+		ClaimDuration            time.Duration `toml:"claim_duration"`
+		AutoHideThreshold        float64       `toml:"auto_hide_threshold"`
+		ReporterFullWeightAge    time.Duration `toml:"reporter_full_weight_age"`
+	}
+
+	emailConfig struct {
+		// "smtp" or "log"
+		Transport    string        `toml:"transport"`
+		From         string        `toml:"from"`
+		PollInterval time.Duration `toml:"poll_interval"`
+		RetryDelay   time.Duration `toml:"retry_delay"`
+		MaxAttempts  int           `toml:"max_attempts"`
+		// base URL of the frontend used in links sent by email
+		LinksUrl                string        `toml:"links_url"`
+		VerificationExpiration  time.Duration `toml:"verification_expiration"`
+		PasswordResetExpiration time.Duration `toml:"password_reset_expiration"`
+		SMTP                    smtpConfig    `toml:"smtp"`
+	}
+
+	smtpConfig struct {
+		Host     string `toml:"host"`
+		Port     int    `toml:"port"`
+		Username string `toml:"username"`
+		Password string `toml:"password"`
+		// "none", "starttls" or "tls"
+		Encryption string `toml:"encryption"`
+	}
+
+	loginConfig struct {
+		// failed attempts older than this are forgotten
+		FailureWindow time.Duration `toml:"failure_window"`
+		// every failure after this many is followed by a delay that doubles each time
+		DelayAfter int           `toml:"delay_after"`
+		BaseDelay  time.Duration `toml:"base_delay"`
+		MaxDelay   time.Duration `toml:"max_delay"`
+		// failures after which logins are locked for lockout_duration
+		UsernameLockoutThreshold int           `toml:"username_lockout_threshold"`
+		IPLockoutThreshold       int           `toml:"ip_lockout_threshold"`
+		LockoutDuration          time.Duration `toml:"lockout_duration"`
 	}
 
 	blacklistConfig struct {
+		// deprecated, imported as content filter rules on startup
 		Words        []string
 		DisplayNames []string
 		Usernames    []string
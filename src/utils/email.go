@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const smtpTimeout = 15 * time.Second
+
+// Every template defines "subject", "text" and "html" blocks.
+// Subject and plain text parts are rendered without HTML escaping.
+//
+//go:embed emails/*.tmpl
+var emailTemplateFiles embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var emailTemplates = make(map[string]emailTemplate)
+
+type EmailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type mailTransport interface {
+	send(from string, msg EmailMessage) error
+}
+
+var mailer mailTransport
+
+// Loads email templates and picks the transport configured in the email section
+func InitMailer() {
+	logger := zap.L()
+
+	files, err := emailTemplateFiles.ReadDir("emails")
+	if err != nil {
+		logger.Fatal("Failed to read email templates", zap.Error(err))
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		filePath := "emails/" + file.Name()
+
+		text, err := texttemplate.ParseFS(emailTemplateFiles, filePath)
+		if err != nil {
+			logger.Fatal("Failed to parse email template", zap.String("template", name), zap.Error(err))
+		}
+		html, err := htmltemplate.ParseFS(emailTemplateFiles, filePath)
+		if err != nil {
+			logger.Fatal("Failed to parse email template", zap.String("template", name), zap.Error(err))
+		}
+
+		emailTemplates[name] = emailTemplate{text, html}
+	}
+
+	if _, err := mail.ParseAddress(Config.Email.From); err != nil {
+		logger.Fatal("Invalid email sender address", zap.String("from", Config.Email.From), zap.Error(err))
+	}
+
+	if Config.Email.PollInterval <= 0 {
+		logger.Fatal("Email poll interval has to be positive", zap.Duration("pollInterval", Config.Email.PollInterval))
+	}
+
+	switch Config.Email.Transport {
+	case "smtp":
+		mailer = smtpTransport{Config.Email.SMTP}
+	case "log":
+		mailer = logTransport{}
+		logger.Warn("Emails are only logged and not delivered! Is it intentional?")
+	case "":
+		// logged emails contain live verification and password reset links so it has to be a conscious choice
+		logger.Fatal("Email transport is not configured, set it to \"smtp\" or \"log\"")
+	default:
+		logger.Fatal("Unsupported email transport", zap.String("transport", Config.Email.Transport))
+	}
+
+	logger.Info("Email templates loaded", zap.Int("count", len(emailTemplates)))
+}
+
+func EmailTemplateExists(name string) bool {
+	_, ok := emailTemplates[name]
+	return ok
+}
+
+// Renders all parts of the template for given recipient
+func RenderEmail(to string, templateName string, data map[string]any) (msg EmailMessage, err error) {
+	tmpl, ok := emailTemplates[templateName]
+	if !ok {
+		return msg, fmt.Errorf("unknown email template '%v'", templateName)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err = tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return
+	}
+	if err = tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return
+	}
+	if err = tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return
+	}
+
+	msg = EmailMessage{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()),
+		HTML:    strings.TrimSpace(html.String()),
+	}
+	return
+}
+
+// Delivers the message using configured transport
+func SendEmail(msg EmailMessage) error {
+	return mailer.send(Config.Email.From, msg)
+}
+
+// Development transport that writes emails to the log instead of sending them
+type logTransport struct{}
+
+func (logTransport) send(from string, msg EmailMessage) error {
+	zap.L().Info("Email",
+		zap.String("from", from),
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("text", msg.Text),
+	)
+	return nil
+}
+
+type smtpTransport struct {
+	cfg smtpConfig
+}
+
+func (t smtpTransport) send(from string, msg EmailMessage) error {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return err
+	}
+	recipient, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	body, err := buildMIMEMessage(sender, recipient, msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if t.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (t smtpTransport) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(t.cfg.Host, strconv.Itoa(t.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: t.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if t.cfg.Encryption == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, t.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if t.cfg.Encryption == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// Builds multipart/alternative message with plain text and HTML parts
+func buildMIMEMessage(from *mail.Address, to *mail.Address, msg EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from.Address, "@"); ok {
+		domain = d
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%v@%v>", hex.EncodeToString(id), domain),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
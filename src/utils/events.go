@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const eventsChannelPrefix = "events:"
+
+// how many events can wait for a slow client before new ones are dropped
+const eventBufferSize = 32
+
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Every instance keeps a single redis subscription and fans events out to its own clients
+var eventHub = struct {
+	sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+}{
+	subscribers: make(map[string]map[chan Event]struct{}),
+}
+
+func UserEventsTopic(userID string) string {
+	return "user:" + userID
+}
+
+func RiceEventsTopic(riceID string) string {
+	return "rice:" + riceID
+}
+
+// Sends the event to clients subscribed to the topic on every API instance
+func PublishEvent(topic string, eventType string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(Event{Type: eventType, Data: encoded})
+	if err != nil {
+		return err
+	}
+
+	return rdb.Publish(context.Background(), eventsChannelPrefix+topic, payload).Err()
+}
+
+// Registers a client interested in given topics. Returned function has to be called once the client disconnects.
+func SubscribeEvents(topics ...string) (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+
+	eventHub.Lock()
+	for _, topic := range topics {
+		if eventHub.subscribers[topic] == nil {
+			eventHub.subscribers[topic] = make(map[chan Event]struct{})
+		}
+		eventHub.subscribers[topic][ch] = struct{}{}
+	}
+	eventHub.Unlock()
+
+	unsubscribe := func() {
+		eventHub.Lock()
+		defer eventHub.Unlock()
+
+		for _, topic := range topics {
+			delete(eventHub.subscribers[topic], ch)
+			if len(eventHub.subscribers[topic]) == 0 {
+				delete(eventHub.subscribers, topic)
+			}
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// Passes events published by any instance to local subscribers. It blocks so it should be run in a goroutine.
+func WatchEvents() {
+	sub := rdb.PSubscribe(context.Background(), eventsChannelPrefix+"*")
+	defer sub.Close()
+
+	for msg := range sub.Channel() {
+		var event Event
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			zap.L().Warn("Received malformed event", zap.String("channel", msg.Channel), zap.Error(err))
+			continue
+		}
+
+		topic := strings.TrimPrefix(msg.Channel, eventsChannelPrefix)
+
+		eventHub.RLock()
+		for ch := range eventHub.subscribers[topic] {
+			// slow clients lose events instead of blocking everyone else
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+		eventHub.RUnlock()
+	}
+}
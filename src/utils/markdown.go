@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"html"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"go.uber.org/zap"
+)
+
+// how many rendered documents are kept in memory
+const markdownCacheSize = 4096
+
+// plain CommonMark, raw HTML is escaped by goldmark unless it's explicitly allowed
+var markdown = goldmark.New()
+
+// Only elements CommonMark can produce are allowed, images are left out on purpose
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "em", "strong", "code", "pre", "blockquote",
+		"ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+
+	return p
+}()
+
+// Rendering the same descriptions and comments over and over is wasteful
+// so recently rendered documents are kept in a small LRU cache keyed by source hash
+var markdownCache = struct {
+	sync.Mutex
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}{
+	order:   list.New(),
+	entries: make(map[[sha256.Size]byte]*list.Element),
+}
+
+type renderedMarkdown struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+// Converts CommonMark source into sanitized HTML
+func RenderMarkdown(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	key := sha256.Sum256([]byte(source))
+
+	markdownCache.Lock()
+	if el, ok := markdownCache.entries[key]; ok {
+		markdownCache.order.MoveToFront(el)
+		markdownCache.Unlock()
+		return el.Value.(renderedMarkdown).html
+	}
+	markdownCache.Unlock()
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		// shouldn't really happen when writing to a buffer, escaped source is better than nothing
+		zap.L().Warn("Failed to render markdown", zap.Error(err))
+		buf.Reset()
+		buf.WriteString("<p>" + html.EscapeString(source) + "</p>")
+	}
+	rendered := markdownPolicy.Sanitize(buf.String())
+
+	markdownCache.Lock()
+	defer markdownCache.Unlock()
+
+	if _, ok := markdownCache.entries[key]; !ok {
+		markdownCache.entries[key] = markdownCache.order.PushFront(renderedMarkdown{key, rendered})
+		if markdownCache.order.Len() > markdownCacheSize {
+			oldest := markdownCache.order.Back()
+			markdownCache.order.Remove(oldest)
+			delete(markdownCache.entries, oldest.Value.(renderedMarkdown).key)
+		}
+	}
+
+	return rendered
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// at most this many users can be mentioned in a single comment
+const maxMentions = 10
+
+// usernames are alphanumeric and 4-14 characters long
+var mentionRegex = regexp.MustCompile(`@([A-Za-z0-9]+)`)
+
+// Finds unique usernames mentioned with "@username" in the text.
+// Mentions preceded by a word character (e.g. emails) are ignored.
+func ParseMentions(text string) []string {
+	seen := make(map[string]bool)
+	usernames := []string{}
+
+	for _, m := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > 0 && isWordChar(text[m[0]-1]) {
+			continue
+		}
+		// the whole word has to be a valid username, not just its prefix
+		if m[1] < len(text) && isWordChar(text[m[1]]) {
+			continue
+		}
+
+		username := text[m[2]:m[3]]
+		if len(username) < 4 || len(username) > 14 {
+			continue
+		}
+
+		// usernames are case insensitive
+		key := strings.ToLower(username)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '@' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime/multipart"
+	"net/http"
+	"ricehub/src/errs"
+)
+
+// dHash works on a (hashWidth + 1) x hashHeight grayscale thumbnail
+// and compares each pixel with its right neighbour, which gives us 64 bits
+const hashWidth = 8
+const hashHeight = 8
+
+var decodeFailed = errs.UserError("Couldn't decode the uploaded image. Make sure it's a valid png/jpeg file.", http.StatusUnprocessableEntity)
+
+// Computes difference hash (dHash) of the uploaded image.
+//
+// Visually similar images (rescaled, recompressed, slightly cropped) produce hashes
+// with a small hamming distance, so it's good enough to catch re-uploaded screenshots.
+func ComputePreviewHash(formFile *multipart.FileHeader) (uint64, error) {
+	file, err := formFile.Open()
+	if err != nil {
+		return 0, openFailed
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, decodeFailed
+	}
+
+	gray := shrinkToGray(img, hashWidth+1, hashHeight)
+
+	var hash uint64
+	for y := range hashHeight {
+		for x := range hashWidth {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// Scales the image down to w x h using box sampling and converts it to grayscale (luma)
+func shrinkToGray(img image.Image, w int, h int) [][]float64 {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	out := make([][]float64, h)
+	for y := range h {
+		out[y] = make([]float64, w)
+
+		y0 := bounds.Min.Y + y*srcH/h
+		y1 := max(bounds.Min.Y+(y+1)*srcH/h, y0+1)
+
+		for x := range w {
+			x0 := bounds.Min.X + x*srcW/w
+			x1 := max(bounds.Min.X+(x+1)*srcW/w, x0+1)
+
+			var sum float64
+			var count int
+			for sy := y0; sy < y1 && sy < bounds.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < bounds.Max.X; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+
+			if count > 0 {
+				out[y][x] = sum / float64(count)
+			}
+		}
+	}
+
+	return out
+}
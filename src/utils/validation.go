@@ -125,52 +125,3 @@ func ValidateFileAsArchive(formFile *multipart.FileHeader) (string, error) {
 
 	return mtype.Extension(), nil
 }
-
-// case-insensitive version of strings.Contains
-func ContainsBlacklistedWord(text string, blacklist []string) bool {
-	text = strings.ToLower(text)
-
-	for _, word := range blacklist {
-		word = strings.ToLower(word)
-
-		// check for whole words and not substrings
-		pattern := `\b` + regexp.QuoteMeta(word) + `\b`
-		re := regexp.MustCompile(pattern)
-
-		if re.MatchString(text) {
-			return true
-		}
-	}
-
-	return false
-}
-
-func IsUsernameBlacklisted(username string) bool {
-	bl := Config.Blacklist
-
-	// check for exact matches
-	exact := append(bl.DisplayNames, bl.Usernames...)
-	for _, word := range exact {
-		if strings.EqualFold(word, username) {
-			return true
-		}
-	}
-
-	// check if contains
-	if ContainsBlacklistedWord(username, bl.Words) {
-		return true
-	}
-
-	return false
-}
-
-func IsDisplayNameBlacklisted(displayName string) bool {
-	bl := Config.Blacklist
-
-	contains := append(bl.Words, bl.DisplayNames...)
-	if ContainsBlacklistedWord(displayName, contains) {
-		return true
-	}
-
-	return false
-}